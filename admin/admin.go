@@ -0,0 +1,287 @@
+//Package admin provides an http.Handler that lets operators inspect and change
+//limio limits on a running service.
+//
+//Limiters and Managers are registered under a name. The Handler serves the
+//following routes, relative to wherever it is mounted:
+//
+//	GET  /               snapshots of every registered Limiter, by name
+//	GET  /{name}         the snapshot of a single Limiter
+//	PUT  /{name}/limit   body {"n": 1048576, "per": "1s"}; calls SimpleLimit
+//	PUT  /{name}/unlimit calls Unlimit
+//	PUT  /{name}/weight  body {"child": "other", "weight": 2}; calls SetWeight
+//
+//The body of the limit route may also give a "burst", and "per" as
+//nanoseconds, so that the rate of a snapshot can be sent back as it is.
+//POST is accepted wherever PUT is. Every response body is JSON, and requests
+//that change limits must pass the Handler's Authorize check.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"astuart.co/limio"
+)
+
+//A SimpleLimiter is a Limiter that can be given a simple rate-based limit,
+//such as a limio.Reader or limio.SimpleManager.
+type SimpleLimiter interface {
+	limio.Limiter
+	SimpleLimit(int, time.Duration) <-chan bool
+}
+
+//A Weighter is a Manager that can change the share of its limit each managed
+//Limiter receives, such as a limio.SimpleManager.
+type Weighter interface {
+	limio.Manager
+	SetWeight(limio.Limiter, int) error
+}
+
+//Handler is an http.Handler exposing registered Limiters. It is safe to
+//Register and Unregister Limiters while serving requests.
+type Handler struct {
+	//Authorize decides whether a request may change limits. A nil Authorize
+	//rejects every change.
+	Authorize func(*http.Request) bool
+
+	mu  sync.RWMutex
+	lms map[string]limio.Limiter
+	mux *http.ServeMux
+}
+
+//NewHandler returns a Handler that authorizes changes carrying the header
+//"Authorization: Bearer <token>". An empty token rejects every change.
+func NewHandler(token string) *Handler {
+	h := &Handler{
+		lms: map[string]limio.Limiter{},
+		mux: http.NewServeMux(),
+	}
+
+	if token != "" {
+		h.Authorize = func(r *http.Request) bool {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+		}
+	}
+
+	h.mux.HandleFunc("GET /{$}", h.list)
+	h.mux.HandleFunc("GET /{name}", h.get)
+	for _, m := range []string{"PUT", "POST"} {
+		h.mux.HandleFunc(m+" /{name}/limit", h.authorized(h.limit))
+		h.mux.HandleFunc(m+" /{name}/unlimit", h.authorized(h.unlimit))
+		h.mux.HandleFunc(m+" /{name}/weight", h.authorized(h.weight))
+	}
+	return h
+}
+
+//Register makes l available under name, replacing any Limiter previously
+//registered under the same name.
+func (h *Handler) Register(name string, l limio.Limiter) {
+	h.mu.Lock()
+	h.lms[name] = l
+	h.mu.Unlock()
+}
+
+//Unregister removes the Limiter registered under name.
+func (h *Handler) Unregister(name string) {
+	h.mu.Lock()
+	delete(h.lms, name)
+	h.mu.Unlock()
+}
+
+//ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+var (
+	errNotFound     = errors.New("no limiter registered with that name")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+func (h *Handler) lookup(name string) (limio.Limiter, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	l, ok := h.lms[name]
+	if !ok {
+		return nil, errNotFound
+	}
+	return l, nil
+}
+
+func (h *Handler) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Authorize == nil || !h.Authorize(r) {
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	lms := make(map[string]limio.Limiter, len(h.lms))
+	for name, l := range h.lms {
+		lms[name] = l
+	}
+	h.mu.RUnlock()
+
+	out := make(map[string]limio.Snapshot, len(lms))
+	for name, l := range lms {
+		out[name] = limio.Describe(l)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	l, err := h.lookup(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, limio.Describe(l))
+}
+
+//LimitRequest is the body accepted by the limit route. Its fields are those of
+//the limio.Rate in a Snapshot, so the Rate read from the handler can be sent
+//back as it is.
+type LimitRequest struct {
+	N     int      `json:"n"`
+	Per   Duration `json:"per"`
+	Burst int      `json:"burst,omitempty"`
+}
+
+//A Duration is a time.Duration that may be given in JSON either as a string
+//such as "1s", or as a number of nanoseconds as a time.Duration is encoded.
+type Duration time.Duration
+
+//UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var ns int64
+		if err := json.Unmarshal(b, &ns); err != nil {
+			return errors.New("per must be a duration string or nanoseconds")
+		}
+		*d = Duration(ns)
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+//A burstLimiter can be given a simple limit with a burst, such as a
+//limio.Reader or limio.SimpleManager.
+type burstLimiter interface {
+	SimpleLimitBurst(int, time.Duration, int) <-chan bool
+}
+
+func (h *Handler) limit(w http.ResponseWriter, r *http.Request) {
+	l, err := h.lookup(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	sl, ok := l.(SimpleLimiter)
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.New("limiter does not support simple limits"))
+		return
+	}
+
+	var req LimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	per := time.Duration(req.Per)
+	if req.N <= 0 || per <= 0 || req.Burst < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("n and per must be positive"))
+		return
+	}
+
+	if req.Burst > 0 {
+		bl, ok := l.(burstLimiter)
+		if !ok {
+			writeError(w, http.StatusBadRequest, errors.New("limiter does not support bursts"))
+			return
+		}
+		bl.SimpleLimitBurst(req.N, per, req.Burst)
+	} else {
+		sl.SimpleLimit(req.N, per)
+	}
+	writeJSON(w, http.StatusOK, limio.Describe(l))
+}
+
+func (h *Handler) unlimit(w http.ResponseWriter, r *http.Request) {
+	l, err := h.lookup(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	l.Unlimit()
+	writeJSON(w, http.StatusOK, limio.Describe(l))
+}
+
+//WeightRequest is the body accepted by the weight route. Child is the
+//registered name of a Limiter managed by the named Manager.
+type WeightRequest struct {
+	Child  string `json:"child"`
+	Weight int    `json:"weight"`
+}
+
+func (h *Handler) weight(w http.ResponseWriter, r *http.Request) {
+	l, err := h.lookup(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	wm, ok := l.(Weighter)
+	if !ok {
+		writeError(w, http.StatusBadRequest, errors.New("limiter does not support weights"))
+		return
+	}
+
+	var req WeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	child, err := h.lookup(req.Child)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := wm.SetWeight(child, req.Weight); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, limio.Describe(l))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"astuart.co/limio"
+)
+
+func do(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	asrt := assert.New(t)
+
+	lm := limio.NewSimpleManager()
+	defer lm.Close()
+
+	r := lm.NewReader(strings.NewReader("foo"))
+	defer r.Close()
+
+	h := NewHandler("secret")
+	h.Register("global", lm)
+	h.Register("conn", r)
+
+	rec := do(h, "GET", "/", "", "")
+	asrt.Equal(http.StatusOK, rec.Code)
+
+	var all map[string]limio.Snapshot
+	asrt.NoError(json.NewDecoder(rec.Body).Decode(&all))
+	asrt.Len(all, 2)
+	asrt.Equal("manager", all["global"].Kind)
+
+	rec = do(h, "GET", "/missing", "", "")
+	asrt.Equal(http.StatusNotFound, rec.Code)
+
+	rec = do(h, "PUT", "/global/limit", "", `{"n": 1024, "per": "1s"}`)
+	asrt.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = do(h, "PUT", "/global/limit", "wrong", `{"n": 1024, "per": "1s"}`)
+	asrt.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = do(h, "PUT", "/global/limit", "secret", `{"n": 1024, "per": "1s"}`)
+	asrt.Equal(http.StatusOK, rec.Code)
+
+	var s limio.Snapshot
+	asrt.NoError(json.NewDecoder(rec.Body).Decode(&s))
+	asrt.Equal(&limio.Rate{N: 1024, Per: time.Second}, s.Rate)
+
+	rec = do(h, "PUT", "/global/limit", "secret", `{"n": 1024, "per": "soon"}`)
+	asrt.Equal(http.StatusBadRequest, rec.Code)
+
+	//What is read can be sent back
+	s.Rate.N, s.Rate.Burst = 2048, 512
+	body, err := json.Marshal(s.Rate)
+	asrt.NoError(err)
+	rec = do(h, "PUT", "/global/limit", "secret", string(body))
+	asrt.Equal(http.StatusOK, rec.Code)
+	asrt.NoError(json.NewDecoder(rec.Body).Decode(&s))
+	asrt.Equal(&limio.Rate{N: 2048, Per: time.Second, Burst: 512}, s.Rate)
+
+	rec = do(h, "POST", "/global/weight", "secret", `{"child": "conn", "weight": 3}`)
+	asrt.Equal(http.StatusOK, rec.Code)
+	asrt.NoError(json.NewDecoder(rec.Body).Decode(&s))
+	if asrt.Len(s.Children, 1) {
+		asrt.Equal(3, s.Children[0].Weight)
+	}
+
+	rec = do(h, "POST", "/conn/weight", "secret", `{"child": "global", "weight": 3}`)
+	asrt.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = do(h, "POST", "/global/unlimit", "secret", "")
+	asrt.Equal(http.StatusOK, rec.Code)
+
+	var after limio.Snapshot
+	asrt.NoError(json.NewDecoder(rec.Body).Decode(&after))
+	asrt.Nil(after.Rate)
+	asrt.False(after.Limited)
+}
@@ -0,0 +1,125 @@
+package limio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//An Algorithm decides, without any background goroutine, whether a quantity
+//of operations may take place at a given instant. When the operations are not
+//allowed, the returned time.Duration is how long the caller should wait before
+//the same request could succeed. A negative duration indicates that the
+//request can never succeed (e.g. it is larger than the configured burst).
+//
+//Implementations in this package are safe for concurrent use.
+type Algorithm interface {
+	AllowN(now time.Time, n int) (bool, time.Duration)
+}
+
+//A Quota is a point-in-time view of an Algorithm's allowance, such as is
+//reported in rate limit response headers. At most Limit operations may take
+//place at once, Remaining of which may take place right now, and the whole
+//allowance is restored after Reset if nothing more takes place.
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+//A QuotaReporter is an Algorithm that can report its Quota at a given instant
+//without using any of it. The Algorithms in this package are all
+//QuotaReporters.
+type QuotaReporter interface {
+	Algorithm
+	Quota(now time.Time) Quota
+}
+
+//Allow is a convenience for asking an Algorithm whether a single operation may
+//take place right now.
+func Allow(a Algorithm) (bool, time.Duration) {
+	return a.AllowN(time.Now(), 1)
+}
+
+//An AlgorithmSource turns an Algorithm into a stream of tokens suitable for
+//handing to any Limiter's Limit method, so that exact algorithms can drive
+//Readers and Managers.
+type AlgorithmSource struct {
+	//C receives a quantum of tokens each time the Algorithm allows one. It
+	//is closed once the AlgorithmSource stops.
+	C chan int
+
+	a       Algorithm
+	quantum int
+	cls     chan struct{}
+	clsOnce *sync.Once
+}
+
+//NewAlgorithmSource starts feeding C with quantum-sized grants permitted by
+//a. Close should be called once the source is no longer needed.
+//
+//It returns an error wrapping ErrInvalidRate if quantum is not positive, or
+//if a is a QuotaReporter whose limit is smaller than quantum, since a would
+//never allow a whole quantum. Other Algorithms that never allow a quantum
+//stop the AlgorithmSource the first time they say so.
+func NewAlgorithmSource(a Algorithm, quantum int) (*AlgorithmSource, error) {
+	if quantum < 1 {
+		return nil, fmt.Errorf("%w: quantum %d is not positive", ErrInvalidRate, quantum)
+	}
+	if qr, ok := a.(QuotaReporter); ok {
+		if l := qr.Quota(time.Now()).Limit; l < quantum {
+			return nil, fmt.Errorf("%w: quantum %d exceeds the limit of %d", ErrInvalidRate, quantum, l)
+		}
+	}
+
+	s := AlgorithmSource{
+		C:       make(chan int),
+		a:       a,
+		quantum: quantum,
+		cls:     make(chan struct{}),
+		clsOnce: &sync.Once{},
+	}
+	go s.run()
+	return &s, nil
+}
+
+func (s *AlgorithmSource) run() {
+	defer close(s.C)
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.cls:
+			return
+		case <-t.C:
+		}
+
+		ok, wait := s.a.AllowN(time.Now(), s.quantum)
+		if wait < 0 {
+			return
+		}
+
+		if ok {
+			select {
+			case s.C <- s.quantum:
+			case <-s.cls:
+				return
+			}
+		}
+
+		t.Reset(wait)
+	}
+}
+
+//Close stops the AlgorithmSource from sending any further tokens. Closing
+//more than once returns ErrClosed.
+func (s *AlgorithmSource) Close() error {
+	err := ErrClosed
+	s.clsOnce.Do(func() {
+		close(s.cls)
+		err = nil
+	})
+	return err
+}
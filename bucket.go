@@ -0,0 +1,344 @@
+package limio
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+//A Bucket is a token bucket that is shared by any number of consumers, who
+//pull tokens from it when they need them rather than having tokens pushed to
+//them. Tokens accrue lazily from a monotonic clock whenever the Bucket is
+//used, so an idle Bucket costs nothing, and consumers waiting for tokens are
+//served in FIFO order by a single timer rather than a background goroutine.
+//
+//A Bucket may also be fed explicitly with Put, for example from a Limiter
+//channel, in which case it does not need a rate at all.
+//
+//A Bucket is safe for concurrent use.
+type Bucket struct {
+	mu sync.Mutex
+
+	unlimited bool
+	perToken  float64 //nanoseconds per token; 0 means tokens only come from Put
+	capacity  float64 //0 means no cap, for Buckets fed only by Put
+	tokens    float64
+	last      time.Time
+
+	waiters *list.List
+	timer   *time.Timer
+
+	taken int64
+
+	now func() time.Time
+}
+
+//A BucketLimiter is a Limiter that can pull its tokens directly from a shared
+//Bucket. Managers can hand a single Bucket to any number of BucketLimiters at
+//no ongoing cost, rather than pushing tokens to each of them.
+type BucketLimiter interface {
+	Limiter
+	LimitBucket(*Bucket) <-chan bool
+}
+
+type bucketWaiter struct {
+	max    int
+	ch     chan int
+	cancel <-chan struct{}
+}
+
+//ErrBucketCanceled is returned by a blocked Bucket operation whose cancel
+//channel is closed before any tokens were granted.
+var ErrBucketCanceled = errors.New("wait for tokens canceled")
+
+//NewBucket returns a Bucket that is initially unlimited.
+func NewBucket() *Bucket {
+	return &Bucket{
+		unlimited: true,
+		waiters:   list.New(),
+		now:       time.Now,
+	}
+}
+
+//SetRate limits the Bucket to n tokens per t, holding at most burst tokens. A
+//burst below 1 defaults to the number of tokens that accrue in DefaultWindow.
+//The Bucket starts full. A rate that is not positive unlimits the Bucket.
+func (b *Bucket) SetRate(n int, t time.Duration, burst int) {
+	if n <= 0 || t <= 0 {
+		b.Unlimit()
+		return
+	}
+	if burst < 1 {
+		burst, _ = Distribute(n, t, DefaultWindow)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.unlimited {
+		b.tokens = float64(burst)
+	}
+	b.unlimited = false
+	b.perToken = float64(t) / float64(n)
+	b.capacity = float64(burst)
+	b.tokens = math.Min(b.tokens, b.capacity)
+	b.serve()
+}
+
+//SetFed limits the Bucket to tokens deposited with Put, discarding any tokens
+//that accrued from a previous rate.
+func (b *Bucket) SetFed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.unlimited = false
+	b.perToken = 0
+	b.capacity = 0
+	b.tokens = 0
+}
+
+//Unlimit removes any limit, immediately satisfying all current and future
+//requests for tokens.
+func (b *Bucket) Unlimit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.unlimited = true
+	b.serve()
+}
+
+//Unlimited reports whether the Bucket is currently unlimited.
+func (b *Bucket) Unlimited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.unlimited
+}
+
+//Put deposits n tokens into the Bucket, such as tokens received from a parent
+//Limiter or tokens that were taken but went unused.
+func (b *Bucket) Put(n int) {
+	if n <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens += float64(n)
+	if b.capacity > 0 {
+		b.tokens = math.Min(b.tokens, b.capacity)
+	}
+	b.serve()
+}
+
+//TryTake takes up to max tokens that are available right now, without
+//waiting, and returns how many were taken.
+func (b *Bucket) TryTake(max int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.waiters.Len() > 0 {
+		return 0
+	}
+
+	b.refill()
+	return b.grant(max)
+}
+
+//Take waits until at least one token is available and takes up to max
+//tokens, returning how many were taken. Waiting consumers are served in the
+//order they arrived.
+func (b *Bucket) Take(ctx context.Context, max int) (int, error) {
+	n, err := b.take(max, ctx.Done(), nil)
+	if err == ErrBucketCanceled {
+		err = ctx.Err()
+	}
+	return n, err
+}
+
+//take waits for tokens until cancel is closed or timeout fires, in which case
+//it returns ErrBucketCanceled or ErrTimeoutExceeded respectively.
+func (b *Bucket) take(max int, cancel <-chan struct{}, timeout <-chan time.Time) (int, error) {
+	if max <= 0 {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	select {
+	case <-cancel:
+		//Checked under the lock, so that a consumer canceled before the
+		//Bucket was changed cannot take tokens granted afterwards.
+		b.mu.Unlock()
+		return 0, ErrBucketCanceled
+	default:
+	}
+
+	b.refill()
+	if b.waiters.Len() == 0 {
+		if n := b.grant(max); n > 0 {
+			b.mu.Unlock()
+			return n, nil
+		}
+	}
+
+	w := &bucketWaiter{max: max, ch: make(chan int, 1), cancel: cancel}
+	e := b.waiters.PushBack(w)
+	b.schedule()
+	b.mu.Unlock()
+
+	err := ErrBucketCanceled
+	select {
+	case n := <-w.ch:
+		return n, nil
+	case <-cancel:
+	case <-timeout:
+		err = ErrTimeoutExceeded
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case n := <-w.ch:
+		//Granted concurrently with the cancelation
+		return n, nil
+	default:
+	}
+
+	b.waiters.Remove(e)
+	b.serve()
+	return 0, err
+}
+
+//Acquire implements the limio.Acquirer interface, waiting until n tokens have
+//been taken. Tokens are spent rather than held, so the returned release
+//function does nothing. If ctx is done first, any tokens taken are put back.
+func (b *Bucket) Acquire(ctx context.Context, n int) (func(), error) {
+	if err := b.acquire(ctx, n, nil); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+//acquire waits until n tokens have been taken, calling took (if set) with the
+//number of tokens each time some are taken, and with minus the total if they
+//are put back because ctx is done first.
+func (b *Bucket) acquire(ctx context.Context, n int, took func(int)) error {
+	got := 0
+	for got < n {
+		m, err := b.Take(ctx, n-got)
+		if err != nil {
+			b.Put(got)
+			if took != nil && got > 0 {
+				took(-got)
+			}
+			return err
+		}
+		got += m
+		if took != nil {
+			took(m)
+		}
+	}
+	return nil
+}
+
+//Taken returns the total number of tokens that have been taken from the
+//Bucket.
+func (b *Bucket) Taken() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.taken
+}
+
+//Burst returns the most tokens the Bucket will hold, or 0 if it is unlimited
+//or uncapped.
+func (b *Bucket) Burst() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.unlimited {
+		return 0
+	}
+	return int(b.capacity)
+}
+
+//refill must be called with the lock held.
+func (b *Bucket) refill() {
+	now := b.now()
+	if b.perToken > 0 && !b.last.IsZero() {
+		b.tokens += float64(now.Sub(b.last)) / b.perToken
+		b.tokens = math.Min(b.tokens, b.capacity)
+	}
+	b.last = now
+}
+
+//grant must be called with the lock held. It takes up to max whole tokens.
+func (b *Bucket) grant(max int) int {
+	if b.unlimited {
+		b.taken += int64(max)
+		return max
+	}
+
+	n := int(math.Min(float64(max), math.Floor(b.tokens)))
+	if n < 0 {
+		n = 0
+	}
+	b.tokens -= float64(n)
+	b.taken += int64(n)
+	return n
+}
+
+//serve must be called with the lock held. It hands available tokens to
+//waiters in order and schedules a wakeup for the rest.
+func (b *Bucket) serve() {
+	b.refill()
+	for e := b.waiters.Front(); e != nil; e = b.waiters.Front() {
+		w := e.Value.(*bucketWaiter)
+
+		select {
+		case <-w.cancel:
+			//Canceled but not yet woken; it must not be granted anything
+			b.waiters.Remove(e)
+			continue
+		default:
+		}
+
+		n := b.grant(w.max)
+		if n == 0 {
+			break
+		}
+		w.ch <- n
+		b.waiters.Remove(e)
+	}
+	b.schedule()
+}
+
+//schedule must be called with the lock held. It arranges for serve to be
+//called once the waiter at the front of the queue can receive a token.
+func (b *Bucket) schedule() {
+	if b.waiters.Len() == 0 || b.unlimited || b.perToken == 0 {
+		return
+	}
+
+	wait := time.Duration(math.Ceil((1 - b.tokens) * b.perToken))
+	if wait < 0 {
+		wait = 0
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(wait, b.wake)
+		return
+	}
+	b.timer.Reset(wait)
+}
+
+func (b *Bucket) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.serve()
+}
@@ -0,0 +1,379 @@
+package limio
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+//FeedQuantum is the largest grant a BucketManager will push at once to a
+//managed Limiter that cannot draw from its Bucket directly, when the Bucket
+//itself has no burst size.
+var FeedQuantum = 32 * KB
+
+//A BucketManager is a limio.Manager that scales to very large numbers of
+//managed Limiters. Rather than pushing a slice of its limit to every member on
+//every tick, it shares a single Bucket from which members pull tokens as they
+//need them, so idle members cost nothing and there is no distribution loop.
+//
+//Members implementing BucketLimiter (such as Reader) draw from the Bucket
+//directly. Any other Limiter is given a channel fed by a goroutine that blocks
+//on the Bucket and then on the channel, so it never spins.
+//
+//Because tokens go to whichever member asks first (in FIFO order when the
+//Bucket is exhausted), a BucketManager shares its limit according to demand
+//rather than in fixed equal slices.
+//
+//A BucketManager is safe for concurrent use.
+type BucketManager struct {
+	b *Bucket
+
+	mu      sync.Mutex
+	m       map[Limiter]*bucketMember
+	sweepAt int
+	limited bool
+	closed  bool
+	done    chan<- bool
+	feed    chan struct{}
+
+	name string
+	conf *Rate
+}
+
+type bucketMember struct {
+	done <-chan bool
+	stop chan struct{}
+}
+
+//NewBucketManager creates an unlimited BucketManager.
+func NewBucketManager() *BucketManager {
+	return &BucketManager{
+		b: NewBucket(),
+		m: map[Limiter]*bucketMember{},
+	}
+}
+
+//Bucket returns the Bucket shared by all members of the BucketManager.
+func (bm *BucketManager) Bucket() *Bucket {
+	return bm.b
+}
+
+//SimpleLimit limits the aggregate of all managed Limiters to n per t.
+func (bm *BucketManager) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return bm.SimpleLimitBurst(n, t, 0)
+}
+
+//SimpleLimitBurst is like SimpleLimit, but lets up to burst tokens accumulate
+//while members are idle.
+func (bm *BucketManager) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.closed {
+		return finished()
+	}
+	bm.stopFeed()
+	bm.b.SetRate(n, t, burst)
+	bm.conf = &Rate{N: n, Per: t, Burst: burst}
+	return bm.setLimited()
+}
+
+//Limit implements the limio.Limiter interface. Tokens received on l are
+//deposited in the Bucket for members to draw on.
+func (bm *BucketManager) Limit(l chan int) <-chan bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.closed {
+		return finished()
+	}
+	bm.stopFeed()
+	bm.b.SetFed()
+	bm.conf = nil
+
+	stop := make(chan struct{})
+	bm.feed = stop
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case n, ok := <-l:
+				if !ok {
+					bm.feedClosed(stop)
+					return
+				}
+				bm.b.Put(n)
+			}
+		}
+	}()
+
+	return bm.setLimited()
+}
+
+//Unlimit implements the limio.Limiter interface.
+func (bm *BucketManager) Unlimit() {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.unlimit()
+}
+
+//NOTE must ONLY be called with mu held.
+func (bm *BucketManager) unlimit() {
+	bm.stopFeed()
+	bm.b.Unlimit()
+	bm.conf = nil
+
+	notify(bm.done, false)
+	bm.done = nil
+
+	if bm.limited {
+		bm.limited = false
+		for l, mem := range bm.m {
+			bm.detach(l, mem)
+		}
+	}
+}
+
+//feedClosed unlimits bm when the channel fed by stop is closed, unless a newer
+//limit has replaced it already.
+func (bm *BucketManager) feedClosed(stop chan struct{}) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if bm.feed == stop {
+		bm.unlimit()
+	}
+}
+
+//Manage implements the limio.Manager interface.
+func (bm *BucketManager) Manage(l Limiter) error {
+	if l == Limiter(bm) {
+		return errors.New("a manager cannot manage itself.")
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.closed {
+		return ErrClosed
+	}
+	if _, ok := bm.m[l]; ok {
+		return nil
+	}
+
+	bm.sweep()
+
+	mem := &bucketMember{}
+	bm.m[l] = mem
+	if bm.limited {
+		bm.attach(l, mem)
+	} else {
+		l.Unlimit()
+	}
+	return nil
+}
+
+//Unmanage implements the limio.Manager interface. The Limiter is unlimited
+//unless it has already shut down.
+func (bm *BucketManager) Unmanage(l Limiter) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if mem, ok := bm.m[l]; ok {
+		if bm.limited {
+			bm.detach(l, mem)
+		}
+		delete(bm.m, l)
+	}
+}
+
+//NewReader takes an io.Reader and returns a Reader managed by the
+//BucketManager.
+func (bm *BucketManager) NewReader(r io.Reader) *Reader {
+	lr := NewReader(r)
+	bm.Manage(lr)
+	return lr
+}
+
+//Close unlimits all managed Limiters and releases the BucketManager's
+//resources. Afterwards Manage returns ErrClosed and further limits are
+//ignored. Closing more than once returns ErrClosed.
+func (bm *BucketManager) Close() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.closed {
+		return ErrClosed
+	}
+	bm.closed = true
+
+	bm.stopFeed()
+	bm.b.Unlimit()
+
+	if bm.limited {
+		for l, mem := range bm.m {
+			bm.detach(l, mem)
+		}
+	}
+	bm.limited = false
+	bm.m = map[Limiter]*bucketMember{}
+
+	notify(bm.done, true)
+	bm.done = nil
+	return nil
+}
+
+//SetName assigns a human-readable name to the BucketManager, used by
+//Describe.
+func (bm *BucketManager) SetName(name string) {
+	bm.mu.Lock()
+	bm.name = name
+	bm.mu.Unlock()
+}
+
+//Describe implements the limio.Describer interface.
+func (bm *BucketManager) Describe() Snapshot {
+	return bm.describeTree(describing{})
+}
+
+func (bm *BucketManager) describeTree(path describing) Snapshot {
+	if !path.enter(bm) {
+		return Snapshot{Kind: "bucket-manager", Cycle: true}
+	}
+	defer delete(path, bm)
+
+	bm.mu.Lock()
+	s := Snapshot{
+		Name:    bm.name,
+		Kind:    "bucket-manager",
+		Limited: bm.limited,
+	}
+	if bm.conf != nil {
+		c := *bm.conf
+		s.Rate = &c
+	}
+	children := make([]Limiter, 0, len(bm.m))
+	for l := range bm.m {
+		children = append(children, l)
+	}
+	bm.mu.Unlock()
+
+	taken := bm.b.Taken()
+	s.Stats = Stats{Allocated: taken, Consumed: taken}
+
+	for _, l := range children {
+		s.Children = append(s.Children, path.describe(l))
+	}
+	sort.SliceStable(s.Children, func(i, j int) bool {
+		return s.Children[i].Name < s.Children[j].Name
+	})
+	return s
+}
+
+//NOTE the following must only be called with bm.mu held.
+
+//setLimited attaches every member if the BucketManager was not already
+//limited. Changing an existing limit only touches the Bucket, so it costs the
+//same no matter how many members there are.
+func (bm *BucketManager) setLimited() <-chan bool {
+	notify(bm.done, false)
+	done := make(chan bool, 1)
+	bm.done = done
+
+	if !bm.limited {
+		bm.limited = true
+		for l, mem := range bm.m {
+			bm.attach(l, mem)
+		}
+	}
+	return done
+}
+
+func (bm *BucketManager) stopFeed() {
+	if bm.feed != nil {
+		close(bm.feed)
+		bm.feed = nil
+	}
+}
+
+func (bm *BucketManager) attach(l Limiter, mem *bucketMember) {
+	if bl, ok := l.(BucketLimiter); ok {
+		mem.done = bl.LimitBucket(bm.b)
+		return
+	}
+
+	ch := make(chan int)
+	mem.stop = make(chan struct{})
+	mem.done = l.Limit(ch)
+	go bm.feeder(ch, mem.stop, mem.done)
+}
+
+//detach unlimits l, unless l has already signalled that it is finished.
+func (bm *BucketManager) detach(l Limiter, mem *bucketMember) {
+	if mem.stop != nil {
+		close(mem.stop)
+		mem.stop = nil
+	}
+
+	select {
+	case <-mem.done:
+		return
+	default:
+	}
+	l.Unlimit()
+}
+
+//sweep forgets members that have shut down. Its cost is amortized by only
+//running when the membership has doubled since the last sweep.
+func (bm *BucketManager) sweep() {
+	if len(bm.m) < 64 || len(bm.m) < 2*bm.sweepAt {
+		return
+	}
+
+	for l, mem := range bm.m {
+		select {
+		case fin := <-mem.done:
+			if fin {
+				if mem.stop != nil {
+					close(mem.stop)
+				}
+				delete(bm.m, l)
+			} else {
+				//No longer ours to watch
+				mem.done = nil
+			}
+		default:
+		}
+	}
+	bm.sweepAt = len(bm.m)
+}
+
+//feeder pushes tokens from the Bucket to a Limiter that can only receive
+//them on a channel. It blocks rather than polls, both on the Bucket and on
+//the channel.
+func (bm *BucketManager) feeder(ch chan<- int, stop chan struct{}, done <-chan bool) {
+	for {
+		q := bm.b.Burst()
+		if q <= 0 {
+			q = FeedQuantum
+		}
+
+		n, err := bm.b.take(q, stop, nil)
+		if err != nil {
+			return
+		}
+
+		select {
+		case ch <- n:
+		case <-stop:
+			//The Bucket may have been given a new limit since these tokens
+			//were taken, so they are not returned to it.
+			return
+		case <-done:
+			bm.b.Put(n)
+			return
+		}
+	}
+}
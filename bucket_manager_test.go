@@ -0,0 +1,156 @@
+package limio
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketManager(t *testing.T) {
+	asrt := assert.New(t)
+
+	bm := NewBucketManager()
+	defer bm.Close()
+
+	asrt.Implements((*Manager)(nil), bm)
+	asrt.Error(bm.Manage(bm))
+
+	r1 := bm.NewReader(strings.NewReader(testText))
+	defer r1.Close()
+
+	p := make([]byte, len(testText))
+	n, err := r1.Read(p[:100])
+	asrt.NoError(err)
+	asrt.Equal(100, n, "unlimited managers should not limit readers")
+
+	bm.SimpleLimitBurst(KB, time.Second, 20)
+
+	n, err = r1.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(20, n, "reader should draw the initial burst")
+
+	//A Limiter that only understands channels gets fed
+	cl := &chanLimiter{}
+	asrt.NoError(bm.Manage(cl))
+	asrt.True(<-cl.ch > 0)
+
+	s := bm.Describe()
+	asrt.Equal("bucket-manager", s.Kind)
+	asrt.Len(s.Children, 2)
+
+	bm.Unmanage(cl)
+
+	ch := make(chan int)
+	bm.Limit(ch)
+
+	go func() { ch <- 30 }()
+	n, err = r1.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(30, n, "tokens from the parent channel should reach the reader")
+
+	bm.Unlimit()
+
+	n, err = r1.Read(p)
+	asrt.Equal(io.EOF, err)
+	asrt.Equal(len(testText)-150, n)
+}
+
+func TestBucketManagerClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	bm := NewBucketManager()
+	bm.SimpleLimit(KB, time.Second)
+
+	asrt.NoError(bm.Close())
+	asrt.Equal(ErrClosed, bm.Close())
+	asrt.Equal(ErrClosed, bm.Manage(&idleLimiter{}))
+	asrt.True(<-bm.SimpleLimit(KB, time.Second))
+	asrt.True(<-bm.Limit(make(chan int)))
+}
+
+//chanLimiter only supports the channel-based Limiter contract.
+type chanLimiter struct {
+	ch chan int
+}
+
+func (c *chanLimiter) Limit(ch chan int) <-chan bool {
+	c.ch = ch
+	return make(chan bool, 1)
+}
+
+func (c *chanLimiter) Unlimit() {}
+
+//idleLimiter is a BucketLimiter that never draws tokens, standing in for a
+//connection that is not currently reading.
+type idleLimiter struct {
+	b *Bucket
+}
+
+func (l *idleLimiter) Limit(chan int) <-chan bool { return make(chan bool, 1) }
+func (l *idleLimiter) Unlimit()                   {}
+func (l *idleLimiter) LimitBucket(b *Bucket) <-chan bool {
+	l.b = b
+	return make(chan bool, 1)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func benchmarkBucketManager(b *testing.B, idle int) {
+	bm := NewBucketManager()
+	bm.SimpleLimit(1<<40, time.Second)
+
+	for i := 0; i < idle; i++ {
+		bm.Manage(&idleLimiter{})
+	}
+
+	r := bm.NewReader(zeroReader{})
+	defer func() {
+		bm.Close()
+		r.Close()
+	}()
+
+	p := make([]byte, 32*KB)
+	b.SetBytes(int64(len(p)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Read(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBucketManager10k(b *testing.B)  { benchmarkBucketManager(b, 10000) }
+func BenchmarkBucketManager100k(b *testing.B) { benchmarkBucketManager(b, 100000) }
+
+func benchmarkBucketManagerContended(b *testing.B, members int) {
+	bm := NewBucketManager()
+	defer bm.Close()
+	bm.SimpleLimit(1<<40, time.Second)
+
+	ls := make([]*idleLimiter, members)
+	for i := range ls {
+		ls[i] = &idleLimiter{}
+		bm.Manage(ls[i])
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			ls[i%members].b.Take(context.Background(), KB)
+			i++
+		}
+	})
+}
+
+func BenchmarkBucketManagerContended10k(b *testing.B)  { benchmarkBucketManagerContended(b, 10000) }
+func BenchmarkBucketManagerContended100k(b *testing.B) { benchmarkBucketManagerContended(b, 100000) }
@@ -0,0 +1,113 @@
+package limio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestBucket(t *testing.T) {
+	asrt := assert.New(t)
+
+	clk := &fakeClock{t: time.Now()}
+	b := NewBucket()
+	b.now = clk.now
+
+	asrt.Equal(100, b.TryTake(100), "unlimited buckets grant everything")
+
+	b.SetRate(100, time.Second, 10)
+	asrt.Equal(10, b.Burst())
+	asrt.Equal(10, b.TryTake(50), "bucket should start full")
+	asrt.Equal(0, b.TryTake(50))
+
+	clk.t = clk.t.Add(50 * time.Millisecond)
+	asrt.Equal(5, b.TryTake(50))
+
+	clk.t = clk.t.Add(time.Hour)
+	asrt.Equal(10, b.TryTake(50), "tokens should be capped at the burst")
+
+	b.Put(3)
+	asrt.Equal(3, b.TryTake(50))
+	asrt.Equal(int64(128), b.Taken())
+
+	b.SetFed()
+	clk.t = clk.t.Add(time.Hour)
+	asrt.Equal(0, b.TryTake(50), "fed buckets do not refill")
+	b.Put(20)
+	asrt.Equal(20, b.TryTake(50))
+
+	b.SetRate(0, time.Second, 10)
+	asrt.True(b.Unlimited(), "a zero rate should unlimit")
+	b.SetRate(10, 0, 10)
+	asrt.True(b.Unlimited(), "a zero period should unlimit")
+	asrt.Equal(50, b.TryTake(50))
+}
+
+func TestBucketWaiters(t *testing.T) {
+	asrt := assert.New(t)
+
+	b := NewBucket()
+	b.SetFed()
+
+	got := make(chan int)
+	for i := 0; i < 2; i++ {
+		go func() {
+			n, err := b.Take(context.Background(), 10)
+			asrt.NoError(err)
+			got <- n
+		}()
+	}
+
+	//Wait for both to queue
+	for {
+		b.mu.Lock()
+		waiting := b.waiters.Len()
+		b.mu.Unlock()
+		if waiting == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	asrt.Equal(0, b.TryTake(1), "TryTake must not jump the queue")
+
+	b.Put(15)
+	asrt.Equal(15, <-got+<-got)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	_, err := b.Take(ctx, 10)
+	asrt.Equal(context.Canceled, err)
+
+	go b.Unlimit()
+	n, err := b.Take(context.Background(), 10)
+	asrt.NoError(err)
+	asrt.Equal(10, n)
+}
+
+func TestBucketRate(t *testing.T) {
+	b := NewBucket()
+	b.SetRate(1000, time.Second, 1)
+	b.TryTake(1)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if _, err := b.Take(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := time.Since(start); d < 9*time.Millisecond {
+		t.Errorf("Took 10 tokens at 1000/s in %s", d)
+	}
+}
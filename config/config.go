@@ -0,0 +1,221 @@
+//Package config builds hierarchies of limio SimpleManagers from a declarative
+//YAML or JSON description, and can reload that description in place.
+//
+//A configuration is a flat list of named managers, each of which may set a
+//rate and burst. Every manager but the roots names the parent under which it
+//is managed and its weight within that parent, and is held to both its own
+//rate and its share of the parent's. A manager may also give the limits of
+//each connection it adopts:
+//
+//	managers:
+//	  - name: global
+//	    rate: 100MB/s
+//	    burst: 64KB
+//	  - name: tenant-a
+//	    parent: global
+//	    weight: 2
+//	    rate: 40MB/s
+//	    readers:
+//	      rate: 1MB/s
+//	      burst: 16KB
+//	  - name: tenant-b
+//	    parent: global
+//
+//Rates are parsed with limio.ParseRate and bursts with limio.ParseSize.
+//Connections join the tree at runtime through Tree.NewReader.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"astuart.co/limio"
+)
+
+//Config is the declarative description of a limiter hierarchy.
+type Config struct {
+	Managers []Manager `json:"managers" yaml:"managers"`
+}
+
+//Manager describes a single named SimpleManager. An empty Rate leaves a
+//manager limited only by its parent, if any, and a Weight of zero is treated
+//as the default of 1. Readers, if set, are the limits of every connection
+//the manager adopts through Tree.NewReader.
+type Manager struct {
+	Name    string  `json:"name" yaml:"name"`
+	Parent  string  `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Rate    string  `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst   string  `json:"burst,omitempty" yaml:"burst,omitempty"`
+	Weight  int     `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Readers *Limits `json:"readers,omitempty" yaml:"readers,omitempty"`
+}
+
+//Limits are the rate, burst and weight of a single connection, with the same
+//defaults as for a Manager.
+type Limits struct {
+	Rate   string `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst  string `json:"burst,omitempty" yaml:"burst,omitempty"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+//Parse decodes a Config from YAML. Since JSON is a subset of YAML, JSON
+//documents are accepted as well.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+//ReadFile reads and validates the Config at path. Files ending in .json are
+//decoded strictly as JSON; anything else is decoded as YAML.
+func ReadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c *Config
+	if filepath.Ext(path) == ".json" {
+		c = &Config{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		c, err = Parse(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+//ErrCycle is returned by Validate when managers are each other's ancestors.
+var ErrCycle = errors.New("manager hierarchy contains a cycle")
+
+//Validate checks that manager names are unique, that every parent exists,
+//that the hierarchy has no cycles and that all rates and bursts parse.
+func (c *Config) Validate() error {
+	byName := map[string]Manager{}
+	for _, m := range c.Managers {
+		if m.Name == "" {
+			return errors.New("manager without a name")
+		}
+		if _, ok := byName[m.Name]; ok {
+			return fmt.Errorf("duplicate manager %q", m.Name)
+		}
+		if err := m.limits().validate(); err != nil {
+			return fmt.Errorf("manager %q: %w", m.Name, err)
+		}
+		if m.Readers != nil {
+			if err := m.Readers.validate(); err != nil {
+				return fmt.Errorf("manager %q readers: %w", m.Name, err)
+			}
+		}
+		byName[m.Name] = m
+	}
+
+	for _, m := range c.Managers {
+		seen := map[string]bool{m.Name: true}
+		for p := m.Parent; p != ""; p = byName[p].Parent {
+			if _, ok := byName[p]; !ok {
+				return fmt.Errorf("manager %q: unknown parent %q", m.Name, p)
+			}
+			if seen[p] {
+				return fmt.Errorf("manager %q: %w", m.Name, ErrCycle)
+			}
+			seen[p] = true
+		}
+	}
+	return nil
+}
+
+func (m Manager) limits() Limits {
+	return Limits{Rate: m.Rate, Burst: m.Burst, Weight: m.Weight}
+}
+
+//readers returns the limits of the manager's connections.
+func (m Manager) readers() Limits {
+	if m.Readers == nil {
+		return Limits{}
+	}
+	return *m.Readers
+}
+
+func (l Limits) validate() error {
+	if _, err := l.rate(); err != nil {
+		return err
+	}
+	if l.Weight < 0 {
+		return errors.New("negative weight")
+	}
+	return nil
+}
+
+//rate returns the parsed rate, or nil if it is unlimited.
+func (l Limits) rate() (*limio.Rate, error) {
+	if l.Rate == "" {
+		if l.Burst != "" {
+			return nil, errors.New("burst without a rate")
+		}
+		return nil, nil
+	}
+
+	r, err := limio.ParseRate(l.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Burst != "" {
+		if r.Burst, err = limio.ParseSize(l.Burst); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+func (l Limits) weight() int {
+	if l.Weight == 0 {
+		return 1
+	}
+	return l.Weight
+}
+
+//order returns the managers sorted so that parents come before children. It
+//assumes the Config is valid.
+func (c *Config) order() []Manager {
+	byName := map[string]Manager{}
+	for _, m := range c.Managers {
+		byName[m.Name] = m
+	}
+
+	var out []Manager
+	done := map[string]bool{}
+	var visit func(Manager)
+	visit = func(m Manager) {
+		if done[m.Name] {
+			return
+		}
+		if m.Parent != "" {
+			visit(byName[m.Parent])
+		}
+		done[m.Name] = true
+		out = append(out, m)
+	}
+
+	for _, m := range c.Managers {
+		visit(m)
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"astuart.co/limio"
+)
+
+const testConfig = `
+managers:
+  - name: tenant-a
+    parent: global
+    weight: 3
+  - name: global
+    rate: 1MB/s
+    burst: 64KB
+  - name: tenant-b
+    parent: global
+`
+
+func TestValidate(t *testing.T) {
+	asrt := assert.New(t)
+
+	c, err := Parse([]byte(testConfig))
+	asrt.NoError(err)
+	asrt.NoError(c.Validate())
+	asrt.Len(c.Managers, 3)
+
+	for in, msg := range map[string]string{
+		`{"managers": [{"name": "a", "parent": "b"}, {"name": "b", "parent": "a"}]}`: "cycle",
+		`{"managers": [{"name": "a", "parent": "nope"}]}`:                            "unknown parent",
+		`{"managers": [{"name": "a", "rate": "fast"}]}`:                              "invalid rate",
+		`{"managers": [{"name": "a", "burst": "1KB"}]}`:                              "burst without a rate",
+		`{"managers": [{"name": "a"}, {"name": "a"}]}`:                               "duplicate",
+		`{"managers": [{"name": "a", "readers": {"rate": "slow"}}]}`:                 "readers",
+		`{"managers": [{"name": "a", "readers": {"weight": -1}}]}`:                   "negative weight",
+	} {
+		c, err := Parse([]byte(in))
+		if asrt.NoError(err, in) {
+			err = c.Validate()
+			if asrt.Error(err, in) {
+				asrt.Contains(err.Error(), msg)
+			}
+		}
+	}
+
+	c, _ = Parse([]byte(`{"managers": [{"name": "a", "parent": "a"}]}`))
+	asrt.True(errors.Is(c.Validate(), ErrCycle))
+}
+
+func TestBuildAndApply(t *testing.T) {
+	asrt := assert.New(t)
+
+	c, err := Parse([]byte(testConfig))
+	asrt.NoError(err)
+
+	tree, err := Build(c)
+	asrt.NoError(err)
+
+	r, err := tree.NewReader("tenant-a", strings.NewReader("foo"))
+	asrt.NoError(err)
+	defer func() {
+		tree.Close()
+		r.Close()
+	}()
+
+	_, err = tree.NewReader("nope", strings.NewReader("foo"))
+	asrt.Error(err)
+
+	s := tree.Manager("global").Describe()
+	asrt.Equal(&limio.Rate{N: limio.MB, Per: time.Second, Burst: 64 * limio.KB}, s.Rate)
+	if asrt.Len(s.Children, 2) {
+		asrt.Equal("tenant-a", s.Children[0].Name)
+		asrt.Equal(3, s.Children[0].Weight)
+		asrt.Len(s.Children[0].Children, 1)
+	}
+
+	tenantA := tree.Manager("tenant-a")
+
+	c, err = Parse([]byte(`
+managers:
+  - name: global
+    rate: 2MB/s
+  - name: tenant-a
+    parent: global
+  - name: tenant-c
+    parent: tenant-a
+`))
+	asrt.NoError(err)
+	asrt.NoError(tree.Apply(c))
+
+	asrt.Nil(tree.Manager("tenant-b"))
+	asrt.True(tenantA == tree.Manager("tenant-a"), "existing managers should be updated in place")
+
+	s = tree.Manager("global").Describe()
+	asrt.Equal(&limio.Rate{N: 2 * limio.MB, Per: time.Second}, s.Rate)
+	if asrt.Len(s.Children, 1) {
+		asrt.Equal(1, s.Children[0].Weight)
+		asrt.Len(s.Children[0].Children, 2, "reader and tenant-c")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	asrt := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "limits.json")
+	asrt.NoError(os.WriteFile(path, []byte(`{"managers": [{"name": "global", "rate": "1KB/s"}]}`), 0644))
+
+	tree, err := Load(path)
+	asrt.NoError(err)
+	defer tree.Close()
+
+	asrt.NoError(tree.Watch(path, 5*time.Millisecond))
+
+	asrt.NoError(os.WriteFile(path, []byte(`{"managers": [{"name": "global", "rate": "2KB/s"}]}`), 0644))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if r := tree.Manager("global").Describe().Rate; r != nil && r.N == 2*limio.KB {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Watch did not apply the changed file")
+}
+
+func readFor(r io.Reader, d time.Duration) int64 {
+	done := make(chan int64)
+	go func() {
+		n, _ := io.Copy(io.Discard, r)
+		done <- n
+	}()
+	time.Sleep(d)
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+	return <-done
+}
+
+func TestNestedRates(t *testing.T) {
+	asrt := assert.New(t)
+
+	c, err := Parse([]byte(`
+managers:
+  - name: global
+  - name: tenant
+    parent: global
+    rate: 40KB/s
+  - name: conns
+    parent: global
+    readers:
+      rate: 20KB/s
+`))
+	asrt.NoError(err)
+
+	tree, err := Build(c)
+	asrt.NoError(err)
+	defer tree.Close()
+
+	big := func() io.Reader { return io.LimitReader(zeros{}, int64(10*limio.MB)) }
+
+	r, err := tree.NewReader("tenant", big())
+	asrt.NoError(err)
+	asrt.InDelta(20*limio.KB, readFor(r, 500*time.Millisecond), float64(8*limio.KB))
+
+	r, err = tree.NewReader("conns", big())
+	asrt.NoError(err)
+	asrt.InDelta(10*limio.KB, readFor(r, 500*time.Millisecond), float64(4*limio.KB))
+
+	//Lifting the reader limit applies to Readers already in flight
+	r, err = tree.NewReader("conns", big())
+	asrt.NoError(err)
+	c.Managers[2].Readers = nil
+	asrt.NoError(tree.Apply(c))
+	asrt.Greater(readFor(r, 100*time.Millisecond), int64(100*limio.KB))
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestApplyInvalid(t *testing.T) {
+	asrt := assert.New(t)
+
+	c, err := Parse([]byte(testConfig))
+	asrt.NoError(err)
+	tree, err := Build(c)
+	asrt.NoError(err)
+
+	bad, err := Parse([]byte(`{"managers": [{"name": "global", "rate": "2MB/s"}, {"name": "x", "parent": "nope"}]}`))
+	asrt.NoError(err)
+	asrt.Error(tree.Apply(bad))
+	asrt.Equal(limio.MB, tree.Manager("global").Describe().Rate.N, "nothing should change")
+	asrt.NotNil(tree.Manager("tenant-b"))
+
+	asrt.Error(tree.Watch(os.DevNull, 0))
+
+	//JSON files are decoded strictly
+	path := filepath.Join(t.TempDir(), "limits.json")
+	asrt.NoError(os.WriteFile(path, []byte(`{"managers": [{"name": "global", "rat": "1KB/s"}]}`), 0644))
+	_, err = ReadFile(path)
+	asrt.ErrorContains(err, "unknown field")
+
+	asrt.NoError(tree.Close())
+	asrt.Equal(limio.ErrClosed, tree.Apply(c))
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"astuart.co/limio"
+)
+
+//A Tree is the set of named SimpleManagers built from a Config. Applying a new
+//Config updates the existing managers in place, so Readers already managed by
+//the Tree keep flowing through a reload.
+type Tree struct {
+	mu     sync.Mutex
+	nodes  map[string]*node
+	closed bool
+
+	cls  chan struct{}
+	once sync.Once
+}
+
+//A node is one of the managers of a Tree, along with the Readers it adopted
+//through NewReader.
+type node struct {
+	conf    Manager
+	lm      *limio.SimpleManager
+	capped  *capped //nil for roots, which are limited directly
+	readers map[*limio.Reader]*capped
+}
+
+//A capped Limiter is held both to its share of a parent and to a rate of its
+//own, by way of a limio.Join.
+type capped struct {
+	join *limio.Join
+	cap  *limio.SimpleManager //imposes the Limiter's own rate
+	src  limio.Limiter        //the source managed by the parent
+}
+
+func newCapped(l limio.Limiter) *capped {
+	c := &capped{
+		join: limio.NewJoin(l),
+		cap:  limio.NewSimpleManager(),
+	}
+	c.src = c.join.Parent()
+	//A new manager cannot fail to manage a new source
+	c.cap.Manage(c.join.Parent())
+	return c
+}
+
+//setRate holds the Limiter to r, or to no rate of its own if r is nil.
+func (c *capped) setRate(r *limio.Rate) {
+	if r == nil {
+		c.cap.Unlimit()
+		return
+	}
+	c.cap.SimpleLimitBurst(r.N, r.Per, r.Burst)
+}
+
+//close unlimits the Limiter and stops the Join.
+func (c *capped) close() {
+	c.join.Close()
+	c.cap.Close()
+}
+
+//Load reads the Config at path and builds a Tree from it.
+func Load(path string) (*Tree, error) {
+	c, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Build(c)
+}
+
+//Build validates c and creates a Tree of SimpleManagers from it.
+func Build(c *Config) (*Tree, error) {
+	t := &Tree{
+		nodes: map[string]*node{},
+		cls:   make(chan struct{}),
+	}
+	if err := t.Apply(c); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+//Manager returns the SimpleManager with the given name, or nil if there is
+//none.
+func (t *Tree) Manager(name string) *limio.SimpleManager {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := t.nodes[name]; n != nil {
+		return n.lm
+	}
+	return nil
+}
+
+//NewReader wraps r in a limio.Reader managed by the named manager, with the
+//limits the manager gives its readers. The Reader stays limited by them
+//across reloads until it is closed.
+func (t *Tree) NewReader(manager string, r io.Reader) (*limio.Reader, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.nodes[manager]
+	if n == nil {
+		return nil, fmt.Errorf("no manager named %q", manager)
+	}
+
+	rd := limio.NewReader(r)
+	c := newCapped(rd)
+	if err := n.lm.Manage(c.src); err != nil {
+		c.close()
+		return nil, err
+	}
+	n.readers[rd] = c
+	n.limitReader(c)
+
+	go func() {
+		<-rd.Finished()
+		t.mu.Lock()
+		if n.readers[rd] == c {
+			delete(n.readers, rd)
+		}
+		t.mu.Unlock()
+		c.close()
+	}()
+	return rd, nil
+}
+
+//limitReader applies the node's reader limits to c.
+func (n *node) limitReader(c *capped) {
+	l := n.conf.readers()
+	if err := n.lm.SetWeight(c.src, l.weight()); err != nil {
+		glog.Errorf("limio/config: weighting reader of %s: %v", n.conf.Name, err)
+	}
+	//Validate has already checked the rate parses
+	r, _ := l.rate()
+	c.setRate(r)
+}
+
+//close closes the node's manager, leaving its Readers unlimited.
+func (n *node) close() {
+	for rd, c := range n.readers {
+		c.close()
+		delete(n.readers, rd)
+	}
+	if n.capped != nil {
+		n.capped.close()
+	}
+	n.lm.Close()
+}
+
+//Apply validates c and brings the Tree in line with it. Managers that still
+//exist are updated in place; managers that were removed are closed, which
+//leaves any Readers they managed unlimited. If c is invalid, Apply returns
+//an error without changing anything.
+func (t *Tree) Apply(c *Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return limio.ErrClosed
+	}
+
+	next := map[string]Manager{}
+	for _, m := range c.Managers {
+		next[m.Name] = m
+	}
+
+	for name, n := range t.nodes {
+		if _, ok := next[name]; ok {
+			continue
+		}
+		if p := t.nodes[n.conf.Parent]; p != nil && n.capped != nil {
+			p.lm.Unmanage(n.capped.src)
+		}
+		n.close()
+		delete(t.nodes, name)
+	}
+
+	for _, m := range c.order() {
+		n, existed := t.nodes[m.Name]
+		if !existed {
+			n = &node{
+				lm:      limio.NewSimpleManager(),
+				readers: map[*limio.Reader]*capped{},
+			}
+			n.lm.SetName(m.Name)
+			t.nodes[m.Name] = n
+		}
+		old := n.conf
+		n.conf = m
+
+		moved := !existed || old.Parent != m.Parent
+		if moved && existed {
+			if n.capped != nil {
+				if p := t.nodes[old.Parent]; p != nil {
+					p.lm.Unmanage(n.capped.src)
+				}
+				n.capped.close()
+				n.capped = nil
+			}
+			n.lm.Unlimit()
+		}
+		if moved && m.Parent != "" {
+			n.capped = newCapped(n.lm)
+			if err := t.nodes[m.Parent].lm.Manage(n.capped.src); err != nil {
+				glog.Errorf("limio/config: managing %s under %s: %v", m.Name, m.Parent, err)
+			}
+		}
+
+		if n.capped != nil {
+			if err := t.nodes[m.Parent].lm.SetWeight(n.capped.src, m.limits().weight()); err != nil {
+				glog.Errorf("limio/config: weighting %s: %v", m.Name, err)
+			}
+		}
+
+		if moved || old.Rate != m.Rate || old.Burst != m.Burst {
+			//Validate has already checked the rate parses
+			r, _ := m.limits().rate()
+			switch {
+			case n.capped != nil:
+				n.capped.setRate(r)
+			case r != nil:
+				n.lm.SimpleLimitBurst(r.N, r.Per, r.Burst)
+			case !moved:
+				n.lm.Unlimit()
+			}
+		}
+
+		if existed && old.readers() != m.readers() {
+			for _, c := range n.readers {
+				n.limitReader(c)
+			}
+		}
+	}
+	return nil
+}
+
+//Watch polls the file at path every interval and applies it to the Tree
+//whenever it changes. Files that fail to load are logged and ignored, leaving
+//the previous configuration in effect. Watching stops when the Tree is
+//closed.
+func (t *Tree) Watch(path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %v", interval)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+
+		last := fi
+		for {
+			select {
+			case <-t.cls:
+				return
+			case <-tk.C:
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				glog.Errorf("limio/config: watching %s: %v", path, err)
+				continue
+			}
+			if fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+
+			c, err := ReadFile(path)
+			if err == nil {
+				err = t.Apply(c)
+			}
+			if err != nil {
+				glog.Errorf("limio/config: reloading %s: %v", path, err)
+				continue
+			}
+			glog.V(2).Infof("limio/config: reloaded %s", path)
+		}
+	}()
+	return nil
+}
+
+//Close stops any Watch and closes every manager in the Tree.
+func (t *Tree) Close() error {
+	t.once.Do(func() { close(t.cls) })
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for name, n := range t.nodes {
+		n.close()
+		delete(t.nodes, name)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package limio
+
+import (
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+//A Deadliner is a Limiter with a known amount of work left to do by a
+//deadline, such as a DeadlineReader. An EDFManager favours the Deadliners
+//whose deadlines are soonest.
+type Deadliner interface {
+	Deadline() time.Time
+	Remaining() int64
+}
+
+//A DeadlineReader is a Reader that knows how many bytes it is to read and by
+//when, and paces itself to finish on time using as little bandwidth as it
+//can. Every DefaultWindow it allows the share of the bytes remaining that is
+//due in that window given the time left, so that the rate adapts as reads
+//fall behind or get ahead. Once the deadline has passed or the total has been
+//read, it is unlimited.
+//
+//A DeadlineReader may instead be limited like any other Reader, such as by an
+//EDFManager sharing a budget among several transfers. Unlimit returns it to
+//pacing itself, or leaves it unlimited if it has nothing left to pace.
+type DeadlineReader struct {
+	*Reader
+
+	total    int64
+	deadline time.Time
+
+	mu    *sync.Mutex
+	paced <-chan bool //the done channel of the current self-pacing, if any
+}
+
+//NewDeadlineReader returns a DeadlineReader reading total bytes from r by
+//deadline.
+func NewDeadlineReader(r io.Reader, total int64, deadline time.Time) *DeadlineReader {
+	d := &DeadlineReader{
+		Reader:   NewReader(r),
+		total:    total,
+		deadline: deadline,
+		mu:       &sync.Mutex{},
+	}
+	d.pace()
+	return d
+}
+
+//Deadline implements the limio.Deadliner interface.
+func (d *DeadlineReader) Deadline() time.Time {
+	return d.deadline
+}
+
+//Remaining implements the limio.Deadliner interface, returning the bytes
+//still to be read.
+func (d *DeadlineReader) Remaining() int64 {
+	return max(d.total-d.consumed.Load(), 0)
+}
+
+//Required returns the rate at which the remaining bytes must be read to
+//finish by the deadline, or a zero Rate once the deadline has passed.
+func (d *DeadlineReader) Required() Rate {
+	left := time.Until(d.deadline)
+	if left <= 0 {
+		return Rate{}
+	}
+	n := math.Ceil(float64(d.Remaining()) * float64(time.Second) / float64(left))
+	return Rate{N: int(n), Per: time.Second}
+}
+
+//due returns the bytes that must be read in the next dt to finish by the
+//deadline, or 0 once it has passed.
+func (d *DeadlineReader) due(now time.Time, dt time.Duration) int {
+	left := d.deadline.Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	rem := float64(d.Remaining())
+	return int(math.Ceil(math.Min(rem, rem*float64(dt)/float64(left))))
+}
+
+//Unlimit implements the limio.Limiter interface, removing any limit set on
+//the DeadlineReader so that it paces itself again. Once the deadline has
+//passed or the total has been read, there is nothing to pace and the
+//DeadlineReader is simply unlimited.
+func (d *DeadlineReader) Unlimit() {
+	if d.due(time.Now(), DefaultWindow) == 0 {
+		d.Reader.Unlimit()
+		return
+	}
+	d.pace()
+}
+
+//pace limits the DeadlineReader to the rate due, until another limit is set.
+func (d *DeadlineReader) pace() {
+	ch := make(chan int)
+	done := d.Reader.Limit(ch)
+
+	d.mu.Lock()
+	d.paced = done
+	d.mu.Unlock()
+
+	go func() {
+		defer func() {
+			d.mu.Lock()
+			if d.paced == done {
+				d.paced = nil
+			}
+			d.mu.Unlock()
+		}()
+
+		t := time.NewTicker(DefaultWindow)
+		defer t.Stop()
+
+		last := time.Now()
+		for {
+			select {
+			case <-done:
+				//Limited otherwise, or closed
+				return
+			case now := <-t.C:
+				n := d.due(now, now.Sub(last))
+				last = now
+				if n == 0 {
+					//Done pacing for good; Unlimit will not start again
+					select {
+					case <-done:
+					default:
+						d.Reader.Unlimit()
+					}
+					return
+				}
+
+				select {
+				case ch <- n:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+}
+
+//Describe implements the limio.Describer interface. While the
+//DeadlineReader is pacing itself, its Rate is the rate currently Required.
+func (d *DeadlineReader) Describe() Snapshot {
+	s := d.Reader.Describe()
+	s.Kind = "deadline-reader"
+
+	d.mu.Lock()
+	paced := d.paced != nil
+	d.mu.Unlock()
+
+	if paced {
+		r := d.Required()
+		s.Rate = &r
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+package limio
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadlineReader(t *testing.T) {
+	asrt := assert.New(t)
+
+	text := strings.Repeat("0123456789", 200)
+	start := time.Now()
+	d := NewDeadlineReader(strings.NewReader(text), int64(len(text)), start.Add(200*time.Millisecond))
+	defer d.Close()
+
+	s := d.Describe()
+	asrt.Equal("deadline-reader", s.Kind)
+	asrt.True(s.Limited)
+	if asrt.NotNil(s.Rate) {
+		//2000 bytes in 200ms
+		asrt.InDelta(10000, s.Rate.N, 500)
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := io.CopyBuffer(buf, d, make([]byte, 100))
+	asrt.NoError(err)
+	asrt.Equal(text, buf.String())
+
+	//Neither late nor much earlier than needed
+	asrt.InDelta(200*time.Millisecond, time.Since(start), float64(50*time.Millisecond))
+	asrt.Zero(d.Remaining())
+}
+
+func TestDeadlineReaderLimit(t *testing.T) {
+	asrt := assert.New(t)
+
+	text := strings.Repeat("0123456789", 10)
+	d := NewDeadlineReader(strings.NewReader(text), int64(len(text)), time.Now().Add(time.Hour))
+	defer d.Close()
+
+	//Another limit replaces the pacing
+	done := d.SimpleLimit(1000, time.Second)
+	for d.Describe().Rate.N != 1000 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//Unlimit paces it again
+	d.Unlimit()
+	asrt.False(<-done)
+	asrt.InDelta(0, d.Describe().Rate.N, 1)
+	asrt.True(d.Describe().Limited)
+
+	//Past the deadline, it is unlimited
+	d = NewDeadlineReader(strings.NewReader(text), int64(len(text)), time.Now())
+	defer d.Close()
+	for d.Describe().Limited {
+		time.Sleep(time.Millisecond)
+	}
+	d.Unlimit()
+	asrt.False(d.Describe().Limited, "nothing left to pace")
+	n, err := io.ReadFull(d, make([]byte, 100))
+	asrt.NoError(err)
+	asrt.Equal(100, n)
+}
@@ -0,0 +1,33 @@
+package limio
+
+//A Demander is a Limiter that can report how many tokens it is currently
+//waiting for, such as the unfilled part of the buffer passed to a blocked
+//Read, or the depth of a queue. Managers can use demand to avoid handing
+//tokens to Limiters that have no use for them.
+type Demander interface {
+	Demand() int
+}
+
+//A DemandManager is a SimpleManager that distributes its limit in proportion
+//to the outstanding demand of each managed Limiter, rather than in fixed
+//shares. Members that are not waiting receive nothing, members are never given
+//more than they asked for, and tokens nobody wanted are carried over to the
+//next distribution (up to one grant's worth).
+//
+//Weights set with SetWeight scale each member's demand when there is not
+//enough to go around. Managed Limiters that do not implement Demander are
+//assumed to want an even share.
+type DemandManager struct {
+	*SimpleManager
+}
+
+//NewDemandManager creates and initializes a DemandManager.
+func NewDemandManager() *DemandManager {
+	lm := newSimpleManager()
+	lm.byDemand = true
+	dm := &DemandManager{lm}
+	lm.self = dm
+	go lm.run()
+	return dm
+}
+
@@ -0,0 +1,103 @@
+package limio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//demandLimiter reports a fixed demand and hands its limit channel to the
+//test.
+type demandLimiter struct {
+	demand int
+	chs    chan chan int
+}
+
+func newDemandLimiter(demand int) *demandLimiter {
+	return &demandLimiter{demand: demand, chs: make(chan chan int, 1)}
+}
+
+func (d *demandLimiter) Limit(ch chan int) <-chan bool {
+	d.chs <- ch
+	return make(chan bool, 1)
+}
+
+func (d *demandLimiter) Unlimit()    {}
+func (d *demandLimiter) Demand() int { return d.demand }
+
+func TestDemandManager(t *testing.T) {
+	asrt := assert.New(t)
+
+	dm := NewDemandManager()
+	defer dm.Close()
+	verifyIsManager(dm)
+	asrt.Error(dm.Manage(dm))
+
+	ch := make(chan int, 1)
+	dm.Limit(ch)
+
+	d1, d2, idle := newDemandLimiter(30), newDemandLimiter(10), newDemandLimiter(0)
+	dm.Manage(d1)
+	dm.Manage(d2)
+	dm.Manage(idle)
+	c1, c2, ci := <-d1.chs, <-d2.chs, <-idle.chs
+
+	asrt.Equal(40, dm.Demand())
+
+	//Everyone gets what they asked for, and the rest is carried over
+	ch <- 100
+	asrt.Equal(30, <-c1)
+	asrt.Equal(10, <-c2)
+
+	//Demand exceeds the 100 granted plus the 60 carried over
+	d1.demand, d2.demand = 300, 100
+	ch <- 100
+	asrt.Equal(120, <-c1)
+	asrt.Equal(40, <-c2)
+
+	select {
+	case n := <-ci:
+		t.Errorf("idle limiter was sent %d", n)
+	default:
+	}
+
+	s := dm.Describe()
+	asrt.Equal("demand-manager", s.Kind)
+	asrt.Equal(int64(200), s.Stats.Allocated)
+	asrt.Equal(int64(200), s.Stats.Consumed)
+}
+
+func TestReaderDemand(t *testing.T) {
+	asrt := assert.New(t)
+
+	dm := NewDemandManager()
+	ch := make(chan int, 1)
+	dm.Limit(ch)
+
+	busy := dm.NewReader(strings.NewReader(testText))
+	idle := dm.NewReader(strings.NewReader(testText))
+
+	read := make(chan int)
+	go func() {
+		n, _ := busy.Read(make([]byte, 20))
+		read <- n
+	}()
+
+	for busy.Demand() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.Equal(20, busy.Demand())
+	asrt.Equal(0, idle.Demand())
+
+	ch <- 100
+	asrt.Equal(20, <-read)
+	asrt.Equal(0, busy.Demand())
+
+	dm.Unmanage(busy)
+	dm.Unmanage(idle)
+	dm.Close()
+	busy.Close()
+	idle.Close()
+}
@@ -0,0 +1,145 @@
+package limio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//A Describer is a Limiter that can report its own configuration and state,
+//which is useful for visualizing hierarchies of Managers and Limiters.
+type Describer interface {
+	Describe() Snapshot
+}
+
+//A Snapshot is a point-in-time description of a Limiter. For Managers,
+//Children holds a Snapshot of each managed Limiter. Cycle is set instead on a
+//Manager found among its own descendants, which only a misconfigured
+//hierarchy allows; it is not described again.
+type Snapshot struct {
+	Name     string     `json:"name,omitempty"`
+	Kind     string     `json:"kind"`
+	Limited  bool       `json:"limited"`
+	Rate     *Rate      `json:"rate,omitempty"`
+	Weight   int        `json:"weight,omitempty"`
+	Stats    Stats      `json:"stats"`
+	Children []Snapshot `json:"children,omitempty"`
+	Cycle    bool       `json:"cycle,omitempty"`
+}
+
+//Stats holds the running totals of a Limiter. Allocated counts tokens granted
+//to the Limiter, and Consumed counts tokens it has actually used (for a
+//Manager, the tokens it has passed on to its children). Deficit is the
+//deficit round robin deficit of a Limiter managed by a DRRManager, and
+//HeadStart the bytes a Reader read before its limit took effect, as set with
+//SetHeadStart.
+type Stats struct {
+	Allocated int64 `json:"allocated"`
+	Consumed  int64 `json:"consumed"`
+	Deficit   int64 `json:"deficit,omitempty"`
+	HeadStart int64 `json:"head_start,omitempty"`
+}
+
+//Describe returns a Snapshot of any Limiter, falling back to a description
+//containing only the Limiter's type if it does not implement Describer.
+func Describe(l Limiter) Snapshot {
+	return describing{}.describe(l)
+}
+
+//A treeDescriber is a Describer whose Snapshot includes those of the Limiters
+//it manages, which it describes within path.
+type treeDescriber interface {
+	describeTree(path describing) Snapshot
+}
+
+//describing holds the Managers on the way down from the root of a Snapshot
+//being taken, so that a cycle in the hierarchy ends rather than being
+//followed forever.
+type describing map[any]bool
+
+//describe returns the Snapshot of l, which may be a Limiter or a SlotLimiter.
+func (path describing) describe(l any) Snapshot {
+	if t, ok := l.(treeDescriber); ok {
+		return t.describeTree(path)
+	}
+	if d, ok := l.(Describer); ok {
+		return d.Describe()
+	}
+	return Snapshot{Kind: fmt.Sprintf("%T", l)}
+}
+
+//enter adds the Manager m to path, returning false if it is there already.
+//The caller should remove m once its children have been described.
+func (path describing) enter(m any) bool {
+	if path[m] {
+		return false
+	}
+	path[m] = true
+	return true
+}
+
+//WriteJSON renders the Snapshot tree to w as indented JSON.
+func (s Snapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+//WriteDOT renders the Snapshot tree to w as a Graphviz DOT digraph, with an
+//edge from each Manager to the Limiters it manages.
+func (s Snapshot) WriteDOT(w io.Writer) error {
+	if _, err := io.WriteString(w, "digraph limio {\n\tnode [shape=box];\n"); err != nil {
+		return err
+	}
+
+	id := 0
+	var walk func(Snapshot) (int, error)
+	walk = func(s Snapshot) (int, error) {
+		me := id
+		id++
+
+		if _, err := fmt.Fprintf(w, "\tn%d [label=%q];\n", me, s.label()); err != nil {
+			return me, err
+		}
+
+		for _, c := range s.Children {
+			child, err := walk(c)
+			if err != nil {
+				return me, err
+			}
+			if _, err := fmt.Fprintf(w, "\tn%d -> n%d;\n", me, child); err != nil {
+				return me, err
+			}
+		}
+		return me, nil
+	}
+
+	if _, err := walk(s); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+func (s Snapshot) label() string {
+	lines := []string{s.Kind}
+	if s.Name != "" {
+		lines = []string{s.Name, s.Kind}
+	}
+
+	switch {
+	case s.Cycle:
+		lines = append(lines, "cycle")
+	case s.Rate != nil:
+		lines = append(lines, "rate: "+s.Rate.String())
+	case s.Limited:
+		lines = append(lines, "limited")
+	default:
+		lines = append(lines, "unlimited")
+	}
+
+	lines = append(lines, fmt.Sprintf("allocated: %d, consumed: %d", s.Stats.Allocated, s.Stats.Consumed))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+package limio
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	asrt := assert.New(t)
+
+	root := NewSimpleManager()
+	root.SetName("global")
+	defer root.Close()
+
+	tenant := NewSimpleManager()
+	tenant.SetName("tenant")
+	asrt.NoError(root.Manage(tenant))
+
+	r := tenant.NewReader(strings.NewReader(testText))
+	r.SetName("conn")
+
+	root.SimpleLimit(KB, time.Second)
+
+	s := root.Describe()
+	asrt.Equal("global", s.Name)
+	asrt.Equal("manager", s.Kind)
+	asrt.Equal(&Rate{N: KB, Per: time.Second}, s.Rate)
+
+	if asrt.Len(s.Children, 1) {
+		asrt.Equal("tenant", s.Children[0].Name)
+		asrt.True(s.Children[0].Limited)
+		if asrt.Len(s.Children[0].Children, 1) {
+			asrt.Equal("conn", s.Children[0].Children[0].Name)
+			asrt.Equal("reader", s.Children[0].Children[0].Kind)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	asrt.NoError(s.WriteJSON(buf))
+
+	var decoded Snapshot
+	asrt.NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	asrt.Equal(s, decoded)
+
+	buf.Reset()
+	asrt.NoError(s.WriteDOT(buf))
+	asrt.Contains(buf.String(), "digraph limio")
+	asrt.Contains(buf.String(), "n0 -> n1;")
+	asrt.Contains(buf.String(), "n1 -> n2;")
+}
+
+func TestDescribeCycle(t *testing.T) {
+	asrt := assert.New(t)
+
+	b1, b2 := NewBucketManager(), NewBucketManager()
+	defer b1.Close()
+	defer b2.Close()
+	b1.SetName("b1")
+	asrt.NoError(b1.Manage(b2))
+	asrt.NoError(b2.Manage(b1))
+
+	s := Describe(b1)
+	asrt.Equal("b1", s.Name)
+	if asrt.Len(s.Children, 1) && asrt.Len(s.Children[0].Children, 1) {
+		c := s.Children[0].Children[0]
+		asrt.Equal("bucket-manager", c.Kind)
+		asrt.True(c.Cycle)
+		asrt.Empty(c.Children)
+	}
+	asrt.False(s.Cycle)
+
+	//Nor does a SlotManager deadlock on itself
+	s1, s2 := NewSlotManager(), NewSlotManager()
+	defer s1.Close()
+	defer s2.Close()
+	asrt.NoError(s1.Manage(s2))
+	asrt.NoError(s2.Manage(s1))
+
+	s = s1.Describe()
+	if asrt.Len(s.Children, 1) && asrt.Len(s.Children[0].Children, 1) {
+		asrt.True(s.Children[0].Children[0].Cycle)
+	}
+}
@@ -0,0 +1,190 @@
+package limio
+
+//DefaultQuantum is the quantum used by NewDRRManager when none is given. It
+//matches the buffer size used by io.Copy.
+const DefaultQuantum = 32 * KB
+
+//A DRRManager is a SimpleManager that distributes its limit by deficit round
+//robin, which keeps allocation fair in bytes over time even when managed
+//Limiters ask for very different amounts at once.
+//
+//Each managed Limiter has a quantum (the DRRManager's quantum times its
+//weight, as set with SetWeight) and a deficit. Every time its turn comes
+//round, a Limiter that is waiting has its quantum added to its deficit, and
+//once the deficit covers everything the Limiter is waiting for (its Demand,
+//for Demanders, or one quantum otherwise) it is granted the whole amount at
+//once. A Limiter that is not waiting loses its deficit.
+//
+//Tokens that cannot be granted yet are carried over to the next distribution,
+//so a large request is served in one grant as soon as enough tokens have
+//built up. The deficit of each managed Limiter is reported in its Stats by
+//Describe.
+type DRRManager struct {
+	*SimpleManager
+}
+
+//NewDRRManager creates and initializes a DRRManager with the given quantum,
+//or DefaultQuantum if quantum is not positive.
+func NewDRRManager(quantum int) *DRRManager {
+	if quantum <= 0 {
+		quantum = DefaultQuantum
+	}
+
+	lm := newSimpleManager()
+	lm.drr = &drr{
+		quantum: quantum,
+		deficit: make(map[Limiter]int),
+	}
+	dm := &DRRManager{lm}
+	lm.self = dm
+	go lm.run()
+	return dm
+}
+
+//Deficits returns the current deficit of each managed Limiter.
+func (dm *DRRManager) Deficits() map[Limiter]int {
+	st := dm.state()
+
+	d := make(map[Limiter]int, len(st.children))
+	for _, l := range st.children {
+		d[l] = st.deficits[l]
+	}
+	return d
+}
+
+//drr holds the deficit round robin state of a SimpleManager. It must ONLY be
+//used inside of run() for concurrency safety.
+type drr struct {
+	quantum int
+	deficit map[Limiter]int
+
+	//order is the round robin order of members, in the order they joined,
+	//and head the index of the member whose turn is next. credited is set if
+	//head has already been given its quantum for this turn.
+	order    []Limiter
+	head     int
+	credited bool
+}
+
+//add appends a new member to the round robin order.
+func (d *drr) add(l Limiter) {
+	d.deficit[l] = 0
+	d.order = append(d.order, l)
+}
+
+//remove forgets a member.
+func (d *drr) remove(l Limiter) {
+	delete(d.deficit, l)
+	for i, k := range d.order {
+		if k != l {
+			continue
+		}
+
+		d.order = append(d.order[:i], d.order[i+1:]...)
+		switch {
+		case i < d.head:
+			d.head--
+		case i == d.head:
+			d.credited = false
+		}
+		if d.head >= len(d.order) {
+			d.head = 0
+		}
+		return
+	}
+}
+
+//shares hands out up to total tokens among the members of cp by deficit round
+//robin, returning the grants, the tokens left over, and, if the turn stopped
+//at a member waiting for more tokens than were left, how many it needs.
+func (d *drr) shares(total int, cp map[Limiter]chan int, weight func(Limiter) int) (map[Limiter]int, int, int) {
+	shares := make(map[Limiter]int, len(cp))
+	if len(d.order) == 0 {
+		return shares, total, 0
+	}
+
+	want := make(map[Limiter]int, len(d.order))
+	for _, k := range d.order {
+		if _, ok := cp[k]; !ok {
+			continue
+		}
+		w := d.quantum * weight(k)
+		if dm, ok := k.(Demander); ok {
+			w = max(dm.Demand(), 0)
+		}
+		want[k] = w
+	}
+
+	left := total
+	//skipped counts turns in a row that granted nothing
+	skipped := 0
+	for left > 0 {
+		k := d.order[d.head]
+		w := want[k]
+
+		if w == 0 {
+			d.deficit[k] = 0
+		} else {
+			if !d.credited {
+				d.deficit[k] += d.quantum * weight(k)
+			}
+
+			if d.deficit[k] >= w {
+				if left < w {
+					//Pick up here next time, without crediting k again
+					d.credited = true
+					return shares, left, w
+				}
+
+				shares[k] += w
+				left -= w
+				want[k] = 0
+				//Nothing more is waiting, so the deficit is not kept
+				d.deficit[k] = 0
+				skipped = -1
+			}
+		}
+
+		d.credited = false
+		d.head = (d.head + 1) % len(d.order)
+
+		skipped++
+		if skipped >= len(d.order) {
+			if !d.skipRounds(want, weight) {
+				break
+			}
+			skipped = 0
+		}
+	}
+	return shares, left, 0
+}
+
+//skipRounds credits every waiting member with the quanta of the rounds that
+//would pass before any of them could be granted what it is waiting for,
+//returning false if no member is waiting.
+func (d *drr) skipRounds(want map[Limiter]int, weight func(Limiter) int) bool {
+	rounds := -1
+	for k, w := range want {
+		if w == 0 {
+			continue
+		}
+		q := d.quantum * weight(k)
+		r := (w - d.deficit[k] + q - 1) / q
+		if rounds < 0 || r < rounds {
+			rounds = r
+		}
+	}
+	if rounds < 0 {
+		return false
+	}
+
+	//The next round credits one more quantum.
+	if rounds--; rounds > 0 {
+		for k, w := range want {
+			if w > 0 {
+				d.deficit[k] += rounds * d.quantum * weight(k)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package limio
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDRRManager(t *testing.T) {
+	asrt := assert.New(t)
+
+	dm := NewDRRManager(10)
+	defer dm.Close()
+	verifyIsManager(dm)
+	asrt.Error(dm.Manage(dm))
+
+	ch := make(chan int, 1)
+	dm.Limit(ch)
+
+	big, small := newDemandLimiter(50), newDemandLimiter(5)
+	dm.Manage(big)
+	dm.Manage(small)
+	cb, cs := <-big.chs, <-small.chs
+
+	//The small request is served straight away, while the big one builds up
+	//its deficit
+	ch <- 20
+	asrt.Equal(5, <-cs)
+	asrt.Equal(map[Limiter]int{big: 50, small: 0}, dm.Deficits())
+
+	s := dm.Describe()
+	asrt.Equal("drr-manager", s.Kind)
+	var deficits []int64
+	for _, c := range s.Children {
+		deficits = append(deficits, c.Stats.Deficit)
+	}
+	asrt.ElementsMatch([]int64{50, 0}, deficits)
+
+	//Tokens are saved up until the big request can be granted whole
+	ch <- 20
+	ch <- 20
+	asrt.Equal(50, <-cb)
+	asrt.Equal(5, <-cs)
+	asrt.Equal(map[Limiter]int{big: 0, small: 0}, dm.Deficits())
+
+	dm.Unmanage(big)
+	asrt.Equal(map[Limiter]int{small: 0}, dm.Deficits())
+}
+
+func TestDRRManagerWeights(t *testing.T) {
+	asrt := assert.New(t)
+
+	dm := NewDRRManager(10)
+	defer dm.Close()
+
+	ch := make(chan int, 1)
+	dm.Limit(ch)
+
+	d1, d2 := newDemandLimiter(20), newDemandLimiter(20)
+	dm.Manage(d1)
+	dm.Manage(d2)
+	c1, c2 := <-d1.chs, <-d2.chs
+	dm.SetWeight(d2, 2)
+
+	//d2 reaches its demand in one round and d1 in two
+	ch <- 20
+	asrt.Equal(20, <-c2)
+	ch <- 20
+	asrt.Equal(20, <-c1)
+}
+
+func TestDRRManagerReaders(t *testing.T) {
+	asrt := assert.New(t)
+
+	dm := NewDRRManager(0)
+	defer dm.Close()
+	dm.SimpleLimit(10*MB, time.Second)
+
+	text := strings.Repeat(testText, 1000)
+	r1 := dm.NewReader(strings.NewReader(text))
+	r2 := dm.NewReader(strings.NewReader(text))
+
+	done := make(chan int64)
+	go func() {
+		n, _ := io.CopyN(io.Discard, r1, int64(100*KB))
+		done <- n
+	}()
+	n, _ := io.CopyN(io.Discard, r2, int64(100*KB))
+	asrt.EqualValues(100*KB, n)
+	asrt.EqualValues(100*KB, <-done)
+}
@@ -0,0 +1,98 @@
+package limio
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+//An EDFManager is a SimpleManager that distributes its limit by urgency,
+//earliest deadline first, among Deadliners such as DeadlineReaders.
+//
+//Each distribution first gives every Deadliner, soonest deadline first, the
+//share of its remaining work that is due before the next distribution if it
+//is to finish on time, for as long as the limit allows. Anything left over
+//goes to the Deadliners in the same order, up to all of their remaining
+//work, so that the most urgent finish early and leave room for the rest.
+//Only then do the other managed Limiters, and Deadliners with no work
+//remaining, receive anything, in proportion to their demand as with a
+//DemandManager. Tokens nobody wanted are carried over to the next
+//distribution (up to one grant's worth).
+type EDFManager struct {
+	*SimpleManager
+}
+
+//NewEDFManager creates and initializes an EDFManager.
+func NewEDFManager() *EDFManager {
+	lm := newSimpleManager()
+	lm.edf = &edf{}
+	em := &EDFManager{lm}
+	lm.self = em
+	go lm.run()
+	return em
+}
+
+//edf holds the earliest deadline first state of a SimpleManager. It must ONLY
+//be used inside of run() for concurrency safety.
+type edf struct {
+	//last is when tokens were last distributed, from which the time until
+	//the next distribution is estimated.
+	last time.Time
+}
+
+//shares hands out up to total tokens among the Deadliners of cp by urgency,
+//returning the grants, the tokens left over, and the members of cp that are
+//not Deadliners with work remaining.
+func (e *edf) shares(total int, cp map[Limiter]chan int, joined map[Limiter]time.Time) (map[Limiter]int, int, map[Limiter]chan int) {
+	now := time.Now()
+	dt := DefaultWindow
+	if !e.last.IsZero() {
+		dt = now.Sub(e.last)
+	}
+	e.last = now
+
+	var ds []Limiter
+	rest := map[Limiter]chan int{}
+	for k, ch := range cp {
+		if d, ok := k.(Deadliner); ok && d.Remaining() > 0 {
+			ds = append(ds, k)
+			continue
+		}
+		rest[k] = ch
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		a, b := ds[i].(Deadliner).Deadline(), ds[j].(Deadliner).Deadline()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return joined[ds[i]].Before(joined[ds[j]])
+	})
+
+	shares := make(map[Limiter]int, len(cp))
+	want := make(map[Limiter]int, len(ds))
+	left := total
+	for _, k := range ds {
+		d := k.(Deadliner)
+		rem := d.Remaining()
+		want[k] = int(min(rem, int64(total)))
+
+		due := float64(rem)
+		if until := d.Deadline().Sub(now); until > dt {
+			due = math.Ceil(due * float64(dt) / float64(until))
+		}
+		shares[k] = int(min(due, float64(want[k])))
+	}
+
+	//Most urgent first, for as long as the tokens last
+	for _, k := range ds {
+		s := min(shares[k], left)
+		shares[k] = s
+		left -= s
+	}
+	for _, k := range ds {
+		s := min(want[k]-shares[k], left)
+		shares[k] += s
+		left -= s
+	}
+	return shares, left, rest
+}
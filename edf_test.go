@@ -0,0 +1,93 @@
+package limio
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDeadliner struct {
+	*demandLimiter
+	deadline time.Time
+	rem      int64
+}
+
+func (d *testDeadliner) Deadline() time.Time { return d.deadline }
+func (d *testDeadliner) Remaining() int64    { return d.rem }
+
+func TestEDFShares(t *testing.T) {
+	asrt := assert.New(t)
+
+	now := time.Now()
+	soon := &testDeadliner{newDemandLimiter(0), now.Add(time.Second), 1000}
+	later := &testDeadliner{newDemandLimiter(0), now.Add(10 * time.Second), 1000}
+	other := newDemandLimiter(50)
+	cp := map[Limiter]chan int{soon: nil, later: nil, other: nil}
+	joined := map[Limiter]time.Time{}
+
+	//Only the most urgent gets anything when there is very little
+	e := &edf{last: now.Add(-10 * time.Millisecond)}
+	shares, left, rest := e.shares(5, cp, joined)
+	asrt.Equal(5, shares[soon])
+	asrt.Zero(shares[later])
+	asrt.Zero(left)
+	asrt.Equal(map[Limiter]chan int{other: nil}, rest)
+
+	//Each gets what is due, and the most urgent the rest
+	e.last = time.Now().Add(-10 * time.Millisecond)
+	shares, left, _ = e.shares(100, cp, joined)
+	asrt.InDelta(1, shares[later], 1)
+	asrt.Equal(100, shares[soon]+shares[later])
+	asrt.Zero(left)
+
+	//Whatever the Deadliners cannot use is left for the others
+	shares, left, _ = e.shares(3000, cp, joined)
+	asrt.Equal(1000, shares[soon])
+	asrt.Equal(1000, shares[later])
+	asrt.Equal(1000, left)
+}
+
+func TestEDFManager(t *testing.T) {
+	asrt := assert.New(t)
+
+	em := NewEDFManager()
+	defer em.Close()
+	verifyIsManager(em)
+	asrt.Error(em.Manage(em))
+	em.SimpleLimit(20*KB, time.Second)
+
+	text := strings.Repeat("0123456789", 200)
+	start := time.Now()
+	soon := NewDeadlineReader(strings.NewReader(text), int64(len(text)), start.Add(time.Second))
+	later := NewDeadlineReader(strings.NewReader(text), int64(len(text)), start.Add(2*time.Second))
+	defer soon.Close()
+	defer later.Close()
+	em.Manage(later)
+	em.Manage(soon)
+	asrt.Equal("edf-manager", em.Describe().Kind)
+
+	var mu sync.Mutex
+	var order []*DeadlineReader
+	wg := &sync.WaitGroup{}
+	for _, d := range []*DeadlineReader{soon, later} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := io.CopyBuffer(io.Discard, d, make([]byte, 100))
+			asrt.NoError(err)
+
+			mu.Lock()
+			order = append(order, d)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	//4000 bytes at 20KB/s, most urgent first
+	asrt.Equal([]*DeadlineReader{soon, later}, order)
+	asrt.Less(time.Since(start), 500*time.Millisecond)
+}
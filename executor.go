@@ -0,0 +1,182 @@
+package limio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//A Task is a unit of work run by an Executor.
+type Task func(context.Context) error
+
+//An Executor runs Tasks on a bounded number of workers, at a rate governed by
+//its limit. Each Task has a cost, the number of tokens it must be granted
+//before it starts, so an Executor limited to 200 per second runs at most 200
+//Tasks of cost 1 per second however many workers it has.
+//
+//An Executor paces its workers with a Pacer, so it can likewise be limited
+//directly with SimpleLimit or Limit, or managed by a Manager such as a
+//SimpleManager alongside Readers, and reports the tokens its workers are
+//waiting for as its Demand.
+//
+//An Executor is safe for concurrent use.
+type Executor struct {
+	p *Pacer
+
+	tasks chan *job
+	wg    *sync.WaitGroup
+}
+
+type job struct {
+	ctx  context.Context
+	cost int
+	task Task
+	f    *Future
+}
+
+//A Future is the result of a Task submitted to an Executor.
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+//Done returns a channel that is closed once the Task has finished, or has
+//failed to start.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+//Wait waits for the Task to finish and returns its error, or the reason it
+//could not start (the error of the context it was submitted with, or
+//ErrClosed).
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+func (f *Future) finish(err error) *Future {
+	f.err = err
+	close(f.done)
+	return f
+}
+
+//NewExecutor returns an unlimited Executor with the given number of workers,
+//at least one.
+func NewExecutor(workers int) *Executor {
+	e := &Executor{
+		p:     NewPacer(),
+		tasks: make(chan *job),
+		wg:    &sync.WaitGroup{},
+	}
+
+	for i := 0; i < max(workers, 1); i++ {
+		e.wg.Add(1)
+		go e.work()
+	}
+	return e
+}
+
+//Go submits task with a cost of one token. See Submit.
+func (e *Executor) Go(ctx context.Context, task Task) *Future {
+	return e.Submit(ctx, 1, task)
+}
+
+//Submit waits for a worker to accept task, which runs with ctx once cost
+//tokens have been granted, and returns its Future. Costs below one are
+//treated as one. If ctx is done before the task starts, or the Executor is
+//closed, the Future fails without running task.
+func (e *Executor) Submit(ctx context.Context, cost int, task Task) *Future {
+	j := &job{ctx: ctx, cost: max(cost, 1), task: task, f: &Future{done: make(chan struct{})}}
+
+	if e.p.ctx.Err() != nil {
+		return j.f.finish(ErrClosed)
+	}
+
+	select {
+	case e.tasks <- j:
+		return j.f
+	case <-ctx.Done():
+		return j.f.finish(ctx.Err())
+	case <-e.p.ctx.Done():
+		return j.f.finish(ErrClosed)
+	}
+}
+
+func (e *Executor) work() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case j := <-e.tasks:
+			e.run(j)
+		case <-e.p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Executor) run(j *job) {
+	if _, err := e.p.Acquire(j.ctx, j.cost); err != nil {
+		j.f.finish(err)
+		return
+	}
+	j.f.finish(j.task(j.ctx))
+}
+
+//SimpleLimit limits the Executor to n tokens per t.
+func (e *Executor) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return e.p.SimpleLimit(n, t)
+}
+
+//SimpleLimitBurst is like SimpleLimit, but lets up to burst tokens build up
+//while the Executor is idle.
+func (e *Executor) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	return e.p.SimpleLimitBurst(n, t, burst)
+}
+
+//Limit implements the limio.Limiter interface. Tokens received on l are
+//granted to workers in the order they asked for them.
+func (e *Executor) Limit(l chan int) <-chan bool {
+	return e.p.Limit(l)
+}
+
+//Unlimit implements the limio.Limiter interface.
+func (e *Executor) Unlimit() {
+	e.p.Unlimit()
+}
+
+//Demand implements the limio.Demander interface, returning the tokens workers
+//are waiting for.
+func (e *Executor) Demand() int {
+	return e.p.Demand()
+}
+
+//SetName assigns a human-readable name to the Executor, used by Describe.
+func (e *Executor) SetName(name string) {
+	e.p.SetName(name)
+}
+
+//Describe implements the limio.Describer interface. Allocated counts tokens
+//granted to workers, and Consumed the cost of tasks that have started.
+func (e *Executor) Describe() Snapshot {
+	return e.p.describe("executor")
+}
+
+//Finished implements the limio.Finisher interface, returning a channel that
+//is closed once the Executor is closed.
+func (e *Executor) Finished() <-chan struct{} {
+	return e.p.Finished()
+}
+
+//Close stops the Executor accepting tasks and waits for the tasks that have
+//already started to finish, then reports to its parent that it has shut down.
+//Tasks still waiting for tokens fail with ErrClosed, as does submitting tasks
+//afterwards or closing more than once.
+func (e *Executor) Close() error {
+	if !e.p.stop() {
+		return ErrClosed
+	}
+	e.wg.Wait()
+	e.p.finish()
+	return nil
+}
@@ -0,0 +1,127 @@
+package limio
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutor(t *testing.T) {
+	asrt := assert.New(t)
+
+	e := NewExecutor(4)
+	defer e.Close()
+	asrt.Implements((*Limiter)(nil), e)
+	asrt.Implements((*Demander)(nil), e)
+
+	errBoom := errors.New("boom")
+	asrt.Equal(errBoom, e.Go(context.Background(), func(context.Context) error { return errBoom }).Wait())
+
+	e.SimpleLimit(100, time.Second)
+
+	var ran atomic.Int32
+	start := time.Now()
+	var fs []*Future
+	for i := 0; i < 20; i++ {
+		fs = append(fs, e.Go(context.Background(), func(context.Context) error {
+			ran.Add(1)
+			return nil
+		}))
+	}
+	for _, f := range fs {
+		asrt.NoError(f.Wait())
+	}
+
+	asrt.Equal(int32(20), ran.Load())
+	asrt.True(time.Since(start) > 100*time.Millisecond, "20 tasks at 100/s took %v", time.Since(start))
+
+	s := e.Describe()
+	asrt.True(s.Limited)
+	asrt.Equal(&Rate{N: 100, Per: time.Second}, s.Rate)
+	asrt.Equal(int64(21), s.Stats.Consumed)
+}
+
+func TestExecutorCost(t *testing.T) {
+	asrt := assert.New(t)
+
+	e := NewExecutor(2)
+	defer e.Close()
+
+	ch := make(chan int)
+	e.Limit(ch)
+
+	noop := func(context.Context) error { return nil }
+	f1 := e.Submit(context.Background(), 2, noop)
+	f2 := e.Submit(context.Background(), 2, noop)
+
+	ch <- 3
+	<-f1.Done()
+	for e.Demand() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-f2.Done():
+		t.Fatal("task ran before its cost was paid")
+	default:
+	}
+
+	ch <- 1
+	asrt.NoError(f2.Wait())
+
+	//A canceled task gives back what it was granted
+	ctx, cancel := context.WithCancel(context.Background())
+	f3 := e.Submit(ctx, 5, noop)
+	ch <- 2
+	for e.Demand() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	asrt.Equal(context.Canceled, f3.Wait())
+	asrt.Equal(2, e.p.b.TryTake(10))
+}
+
+func TestExecutorManaged(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+	lmr.SimpleLimit(1000, time.Second)
+
+	e := NewExecutor(2)
+	asrt.NoError(lmr.Manage(e))
+	for !Describe(e).Limited {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		asrt.NoError(e.Go(context.Background(), func(context.Context) error { return nil }).Wait())
+	}
+
+	//Closing the Executor removes it from the Manager
+	asrt.NoError(e.Close())
+	for len(lmr.Describe().Children) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExecutorClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	e := NewExecutor(1)
+	done := e.Limit(make(chan int))
+
+	f := e.Go(context.Background(), func(context.Context) error { return nil })
+	for e.Demand() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	asrt.NoError(e.Close())
+	asrt.Equal(ErrClosed, f.Wait(), "tasks waiting for tokens do not run")
+	asrt.True(<-done)
+	asrt.Equal(ErrClosed, e.Go(context.Background(), nil).Wait())
+	asrt.Equal(ErrClosed, e.Close())
+}
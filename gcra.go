@@ -0,0 +1,77 @@
+package limio
+
+import (
+	"sync"
+	"time"
+)
+
+//GCRA implements the generic cell rate algorithm (virtual scheduling) as an
+//Algorithm. It admits n operations per t on average, while allowing up to
+//burst operations to take place at once.
+type GCRA struct {
+	mu sync.Mutex
+
+	emission time.Duration
+	burst    int
+	tat      time.Time
+}
+
+//NewGCRA returns a GCRA admitting n operations per t with the given burst. A
+//burst below 1 is treated as 1. NewGCRA panics if n or t is not positive.
+//Rates faster than one operation per nanosecond are treated as one per
+//nanosecond.
+func NewGCRA(n int, t time.Duration, burst int) *GCRA {
+	if n <= 0 || t <= 0 {
+		panic("limio: non-positive rate for NewGCRA")
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &GCRA{
+		emission: max(t/time.Duration(n), 1),
+		burst:    burst,
+	}
+}
+
+//AllowN implements the limio.Algorithm interface.
+func (g *GCRA) AllowN(now time.Time, n int) (bool, time.Duration) {
+	if n > g.burst {
+		return false, -1
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(time.Duration(n) * g.emission)
+	allowAt := newTat.Add(-time.Duration(g.burst) * g.emission)
+
+	if now.Before(allowAt) {
+		return false, allowAt.Sub(now)
+	}
+
+	g.tat = newTat
+	return true, 0
+}
+
+//Quota implements the limio.QuotaReporter interface.
+func (g *GCRA) Quota(now time.Time) Quota {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	used := max(g.tat.Sub(now), 0)
+	if g.emission <= 0 {
+		//Not made by NewGCRA; nothing is ever used up
+		return Quota{Limit: g.burst, Remaining: g.burst}
+	}
+	rem := g.burst - int((used+g.emission-1)/g.emission)
+	return Quota{
+		Limit:     g.burst,
+		Remaining: max(rem, 0),
+		Reset:     used,
+	}
+}
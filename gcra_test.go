@@ -0,0 +1,96 @@
+package limio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCRA(t *testing.T) {
+	asrt := assert.New(t)
+
+	g := NewGCRA(10, time.Second, 2)
+	now := time.Now()
+
+	ok, _ := g.AllowN(now, 1)
+	asrt.True(ok)
+	ok, _ = g.AllowN(now, 1)
+	asrt.True(ok, "burst of 2 should be allowed")
+
+	ok, wait := g.AllowN(now, 1)
+	asrt.False(ok)
+	asrt.Equal(100*time.Millisecond, wait)
+
+	ok, _ = g.AllowN(now.Add(wait), 1)
+	asrt.True(ok)
+
+	ok, wait = g.AllowN(now, 3)
+	asrt.False(ok)
+	asrt.True(wait < 0, "requests larger than the burst can never succeed")
+}
+
+func TestGCRAQuota(t *testing.T) {
+	asrt := assert.New(t)
+
+	g := NewGCRA(10, time.Second, 3)
+	now := time.Now()
+	asrt.Implements((*QuotaReporter)(nil), g)
+	asrt.Equal(Quota{Limit: 3, Remaining: 3}, g.Quota(now))
+
+	g.AllowN(now, 2)
+	asrt.Equal(Quota{Limit: 3, Remaining: 1, Reset: 200 * time.Millisecond}, g.Quota(now))
+	asrt.Equal(Quota{Limit: 3, Remaining: 2, Reset: 50 * time.Millisecond}, g.Quota(now.Add(150*time.Millisecond)))
+
+	//The zero GCRA must not divide by zero
+	asrt.Equal(Quota{}, (&GCRA{}).Quota(now))
+}
+
+func TestAlgorithmSource(t *testing.T) {
+	s, err := NewAlgorithmSource(NewGCRA(1000, time.Second, 10), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	r := NewReader(&tStr{s: testText})
+	r.Limit(s.C)
+
+	p := make([]byte, 10)
+	n, err := r.Read(p)
+
+	if err != nil {
+		t.Errorf("Error reading: %v", err)
+	}
+
+	if n != 10 {
+		t.Errorf("Wrong number of bytes read: %d", n)
+	}
+
+	//C is closed once the source stops
+	s.Close()
+	for range s.C {
+	}
+	if err := s.Close(); err != ErrClosed {
+		t.Errorf("Closing twice should return ErrClosed, got %v", err)
+	}
+}
+
+func TestAlgorithmSourceInvalid(t *testing.T) {
+	asrt := assert.New(t)
+
+	_, err := NewAlgorithmSource(NewGCRA(1000, time.Second, 10), 11)
+	asrt.ErrorIs(err, ErrInvalidRate)
+	_, err = NewAlgorithmSource(NewGCRA(1000, time.Second, 10), 0)
+	asrt.ErrorIs(err, ErrInvalidRate)
+
+	asrt.Panics(func() { NewGCRA(0, time.Second, 1) })
+
+	//Faster than one per nanosecond still limits
+	g := NewGCRA(10, time.Nanosecond, 1)
+	now := time.Now()
+	ok, _ := g.AllowN(now, 1)
+	asrt.True(ok)
+	ok, _ = g.AllowN(now, 1)
+	asrt.False(ok)
+}
@@ -0,0 +1,493 @@
+//Package httplimit provides HTTP middleware built on limio limits.
+//
+//A Queue admits requests one operation token at a time. It is a limio.Limiter,
+//so the tokens can come from any limio Manager or limit channel, and requests
+//that arrive while no token is available wait in a bounded queue. Requests
+//that cannot be admitted in time are rejected with 429 Too Many Requests and
+//a Retry-After header computed from the rate at which tokens are arriving.
+//
+//A RateLimiter limits requests per key with a limio.Algorithm, writing rate
+//limit headers derived from the Algorithm's live state on every response, and
+//a Transport is a client that throttles itself according to those headers.
+package httplimit
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"astuart.co/limio"
+)
+
+//DefaultMaxQueue is the queue length used when Options.MaxQueue is not set.
+const DefaultMaxQueue = 64
+
+//rateTau is the time constant of the estimate of the rate at which tokens
+//arrive, and rateSample the shortest interval it is updated over.
+const (
+	rateTau    = time.Second
+	rateSample = 10 * time.Millisecond
+)
+
+//Options configure a Queue.
+type Options struct {
+	//MaxQueue is the most requests that may wait for a token at once.
+	//Requests arriving when the queue is full are rejected. Zero means
+	//DefaultMaxQueue.
+	MaxQueue int
+
+	//MaxWait is the longest a request may wait for a token. Requests whose
+	//predicted wait exceeds MaxWait are rejected on arrival, and requests
+	//still waiting after MaxWait are rejected then. Zero means no budget.
+	MaxWait time.Duration
+
+	//Burst is the most tokens that may be saved up while no request is
+	//waiting. Zero means 1.
+	Burst int
+
+	//CoDel, if set, sheds requests based on how long they have been queued
+	//rather than how many are waiting.
+	CoDel *CoDel
+}
+
+//CoDel configures Controlled Delay load shedding (RFC 8289). Once requests
+//have been queued for longer than Target for at least Interval, a Queue starts
+//rejecting requests as they are dequeued, more often the longer the delay
+//persists, until queueing delay falls below Target again.
+type CoDel struct {
+	Target   time.Duration
+	Interval time.Duration
+}
+
+//Reasons a request can be rejected, wrapped in a RejectedError.
+var (
+	ErrQueueFull  = errors.New("admission queue is full")
+	ErrOverBudget = errors.New("wait for admission exceeds budget")
+	ErrShed       = errors.New("request shed by queue delay")
+)
+
+//A RejectedError reports that a Queue turned a request away, and when it is
+//worth trying again.
+type RejectedError struct {
+	Reason     error
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%v; retry after %v", e.Reason, e.RetryAfter)
+}
+
+//Unwrap returns the reason the request was rejected.
+func (e *RejectedError) Unwrap() error {
+	return e.Reason
+}
+
+//A Queue admits operations, such as HTTP requests, one token per operation.
+//It implements limio.Limiter: every token received on its limit channel
+//admits one operation, and an unlimited Queue admits everything. It also
+//implements limio.Demander, reporting how many operations are waiting, and
+//limio.Describer.
+//
+//A Queue is safe for concurrent use.
+type Queue struct {
+	mu sync.Mutex
+
+	opts Options
+
+	unlimited bool
+	closed    bool
+	tokens    int
+	waiters   *list.List
+	feed      chan struct{}
+	done      chan bool
+
+	rate    float64 //estimated tokens per second
+	pending int
+	last    time.Time
+	codel   codel
+
+	allocated int64
+	admitted  int64
+
+	now func() time.Time
+}
+
+type waiter struct {
+	ch chan error
+	at time.Time
+}
+
+//NewQueue returns a Queue configured by opts. It is initially unlimited.
+func NewQueue(opts Options) *Queue {
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = DefaultMaxQueue
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+
+	return &Queue{
+		opts:      opts,
+		unlimited: true,
+		waiters:   list.New(),
+		now:       time.Now,
+	}
+}
+
+//Limit implements the limio.Limiter interface. Each token received on l
+//admits one operation.
+func (q *Queue) Limit(l chan int) <-chan bool {
+	done := make(chan bool, 1)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		limio.Notify(done, true)
+		return done
+	}
+	q.stopFeed()
+	limio.Notify(q.done, false)
+	q.unlimited = false
+	q.tokens = 0
+	q.rate, q.pending, q.last = 0, 0, time.Time{}
+
+	stop := make(chan struct{})
+	q.feed = stop
+	q.done = done
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case n, ok := <-l:
+				if !ok {
+					q.feedClosed(stop)
+					return
+				}
+				q.put(n)
+			}
+		}
+	}()
+
+	return done
+}
+
+//Unlimit implements the limio.Limiter interface, admitting every waiting and
+//future operation.
+func (q *Queue) Unlimit() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.unlimit()
+}
+
+//NOTE must ONLY be called with mu held.
+func (q *Queue) unlimit() {
+	q.stopFeed()
+	limio.Notify(q.done, false)
+	q.done = nil
+	q.unlimited = true
+	q.serve()
+}
+
+//feedClosed unlimits q when the channel fed by stop is closed, unless a newer
+//limit has replaced it already.
+func (q *Queue) feedClosed(stop chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.feed == stop {
+		q.unlimit()
+	}
+}
+
+//Demand implements the limio.Demander interface, returning the number of
+//operations waiting for a token.
+func (q *Queue) Demand() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+//Describe implements the limio.Describer interface. Allocated counts tokens
+//received and Consumed counts operations admitted.
+func (q *Queue) Describe() limio.Snapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return limio.Snapshot{
+		Kind:    "admission-queue",
+		Limited: !q.unlimited,
+		Stats: limio.Stats{
+			Allocated: q.allocated,
+			Consumed:  q.admitted,
+		},
+	}
+}
+
+//Close rejects every waiting and future operation with limio.ErrClosed and
+//reports to the Queue's parent that it has shut down. Closing more than once
+//returns limio.ErrClosed.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return limio.ErrClosed
+	}
+	q.closed = true
+	q.stopFeed()
+
+	for e := q.waiters.Front(); e != nil; e = q.waiters.Front() {
+		q.waiters.Remove(e)
+		e.Value.(*waiter).ch <- limio.ErrClosed
+	}
+	limio.Notify(q.done, true)
+	q.done = nil
+	return nil
+}
+
+//Admit waits for a token to admit one operation. It returns a
+//*RejectedError if the queue is full, the predicted or actual wait exceeds the
+//budget, or the operation is shed, limio.ErrClosed if the Queue is closed, and
+//ctx.Err() if ctx is done first.
+func (q *Queue) Admit(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return limio.ErrClosed
+	}
+
+	if q.unlimited || (q.waiters.Len() == 0 && q.tokens > 0) {
+		if !q.unlimited {
+			q.tokens--
+		}
+		q.admitted++
+		q.mu.Unlock()
+		return nil
+	}
+
+	pos := q.waiters.Len() + 1
+	if pos > q.opts.MaxQueue {
+		err := q.reject(ErrQueueFull)
+		q.mu.Unlock()
+		return err
+	}
+	if wait, ok := q.predict(pos); ok && q.opts.MaxWait > 0 && wait > q.opts.MaxWait {
+		err := q.reject(ErrOverBudget)
+		q.mu.Unlock()
+		return err
+	}
+
+	w := &waiter{ch: make(chan error, 1), at: q.now()}
+	e := q.waiters.PushBack(w)
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.opts.MaxWait > 0 {
+		t := time.NewTimer(q.opts.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	err := ErrOverBudget
+	select {
+	case err := <-w.ch:
+		return err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case err := <-w.ch:
+		//Served while we were giving up
+		return err
+	default:
+	}
+	q.waiters.Remove(e)
+
+	if err == ErrOverBudget {
+		return q.reject(err)
+	}
+	return err
+}
+
+//Wrap returns middleware that admits each request to next through the Queue.
+//Rejected requests are answered with 429 Too Many Requests and a Retry-After
+//header, and requests arriving after the Queue is closed with 503 Service
+//Unavailable. Requests whose context is done while waiting are dropped
+//without a response.
+func (q *Queue) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := q.Admit(r.Context())
+
+		var rej *RejectedError
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.As(err, &rej):
+			tooManyRequests(w, rej.Reason.Error(), rej.RetryAfter)
+		case err == limio.ErrClosed:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+//retryAfter returns d in whole seconds for a Retry-After header, rounded up
+//and no less than one.
+func retryAfter(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
+
+//NOTE must ONLY be called with mu held.
+func (q *Queue) stopFeed() {
+	if q.feed != nil {
+		close(q.feed)
+		q.feed = nil
+	}
+}
+
+//put deposits n tokens and admits as many waiting operations as they allow.
+func (q *Queue) put(n int) {
+	if n <= 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.allocated += int64(n)
+	q.observe(n, q.now())
+
+	q.tokens += n
+	q.serve()
+	q.tokens = min(q.tokens, q.opts.Burst)
+}
+
+//NOTE must ONLY be called with mu held.
+//serve admits waiting operations in FIFO order while tokens last, shedding
+//those CoDel drops.
+func (q *Queue) serve() {
+	now := q.now()
+	for q.waiters.Len() > 0 && (q.unlimited || q.tokens > 0) {
+		e := q.waiters.Front()
+		q.waiters.Remove(e)
+		w := e.Value.(*waiter)
+
+		if !q.unlimited && q.opts.CoDel != nil && q.codel.drop(*q.opts.CoDel, now.Sub(w.at), now, q.waiters.Len() == 0) {
+			w.ch <- q.reject(ErrShed)
+			continue
+		}
+
+		if !q.unlimited {
+			q.tokens--
+		}
+		q.admitted++
+		w.ch <- nil
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+//observe updates the estimate of the rate at which tokens arrive.
+func (q *Queue) observe(n int, now time.Time) {
+	if q.last.IsZero() {
+		//Tokens before the first interval say nothing about the rate
+		q.last = now
+		return
+	}
+	q.pending += n
+
+	dt := now.Sub(q.last)
+	if dt < rateSample {
+		return
+	}
+
+	r := float64(q.pending) / dt.Seconds()
+	if q.rate == 0 {
+		q.rate = r
+	} else {
+		q.rate += (1 - math.Exp(-float64(dt)/float64(rateTau))) * (r - q.rate)
+	}
+	q.pending, q.last = 0, now
+}
+
+//NOTE must ONLY be called with mu held.
+//predict returns how long the operation at position pos in the queue can
+//expect to wait, or false if the rate of tokens is not yet known.
+func (q *Queue) predict(pos int) (time.Duration, bool) {
+	if q.rate <= 0 {
+		return 0, false
+	}
+	need := max(pos-q.tokens, 0)
+	return time.Duration(float64(need) / q.rate * float64(time.Second)), true
+}
+
+//NOTE must ONLY be called with mu held.
+//reject returns a RejectedError for reason, suggesting a retry once the
+//current queue could have been served.
+func (q *Queue) reject(reason error) *RejectedError {
+	after, ok := q.predict(q.waiters.Len() + 1)
+	if !ok {
+		after = time.Second
+	}
+	return &RejectedError{Reason: reason, RetryAfter: after}
+}
+
+//codel holds the state of CoDel's control law.
+type codel struct {
+	firstAbove time.Time
+	dropping   bool
+	dropNext   time.Time
+	count      int
+}
+
+//drop reports whether an operation dequeued at now after waiting sojourn
+//should be shed. last is set if no other operations are waiting.
+func (c *codel) drop(cfg CoDel, sojourn time.Duration, now time.Time, last bool) bool {
+	if sojourn < cfg.Target || last {
+		c.firstAbove = time.Time{}
+		c.dropping = false
+		return false
+	}
+
+	if c.firstAbove.IsZero() {
+		c.firstAbove = now.Add(cfg.Interval)
+		return false
+	}
+
+	if !c.dropping {
+		if now.Before(c.firstAbove) {
+			return false
+		}
+		c.dropping = true
+
+		//Resume near the previous drop rate if we were dropping recently
+		if c.count > 2 && now.Sub(c.dropNext) < 16*cfg.Interval {
+			c.count -= 2
+		} else {
+			c.count = 1
+		}
+		c.dropNext = c.controlLaw(cfg, now)
+		return true
+	}
+
+	if now.Before(c.dropNext) {
+		return false
+	}
+	c.count++
+	c.dropNext = c.controlLaw(cfg, c.dropNext)
+	return true
+}
+
+//controlLaw returns when to drop next, sooner the more drops there have been.
+func (c *codel) controlLaw(cfg CoDel, t time.Time) time.Time {
+	return t.Add(time.Duration(float64(cfg.Interval) / math.Sqrt(float64(c.count))))
+}
@@ -0,0 +1,245 @@
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"astuart.co/limio"
+	"github.com/stretchr/testify/assert"
+)
+
+//waitDemand waits until n operations are queued.
+func waitDemand(q *Queue, n int) {
+	for q.Demand() != n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueAdmit(t *testing.T) {
+	asrt := assert.New(t)
+
+	q := NewQueue(Options{MaxQueue: 1})
+	defer q.Close()
+	asrt.Implements((*limio.Limiter)(nil), q)
+	asrt.Implements((*limio.Demander)(nil), q)
+
+	asrt.NoError(q.Admit(context.Background()), "an unlimited queue admits everything")
+
+	ch := make(chan int, 1)
+	q.Limit(ch)
+
+	res := make(chan error)
+	go func() { res <- q.Admit(context.Background()) }()
+	waitDemand(q, 1)
+
+	//The queue is full
+	err := q.Admit(context.Background())
+	var rej *RejectedError
+	asrt.True(errors.As(err, &rej))
+	asrt.ErrorIs(err, ErrQueueFull)
+	asrt.Equal(time.Second, rej.RetryAfter, "no rate is known yet")
+
+	ch <- 1
+	asrt.NoError(<-res)
+
+	//Canceled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { res <- q.Admit(ctx) }()
+	waitDemand(q, 1)
+	cancel()
+	asrt.Equal(context.Canceled, <-res)
+	asrt.Equal(0, q.Demand())
+
+	s := q.Describe()
+	asrt.True(s.Limited)
+	asrt.Equal(int64(1), s.Stats.Allocated)
+	asrt.Equal(int64(2), s.Stats.Consumed)
+}
+
+func TestQueueBudget(t *testing.T) {
+	asrt := assert.New(t)
+
+	q := NewQueue(Options{MaxWait: 1500 * time.Millisecond})
+	defer q.Close()
+	q.Limit(make(chan int))
+
+	//Tokens arrive at one per second
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	q.put(1)
+	now = now.Add(time.Second)
+	q.put(1)
+	asrt.NoError(q.Admit(context.Background()))
+
+	//The first in line expects to wait a second, the second two
+	go q.Admit(context.Background())
+	waitDemand(q, 1)
+
+	err := q.Admit(context.Background())
+	var rej *RejectedError
+	asrt.True(errors.As(err, &rej))
+	asrt.ErrorIs(err, ErrOverBudget)
+	asrt.Equal(2*time.Second, rej.RetryAfter)
+}
+
+func TestQueueMaxWait(t *testing.T) {
+	q := NewQueue(Options{MaxWait: 10 * time.Millisecond})
+	defer q.Close()
+	q.Limit(make(chan int))
+
+	assert.ErrorIs(t, q.Admit(context.Background()), ErrOverBudget)
+	assert.Equal(t, 0, q.Demand())
+}
+
+func TestQueueClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	q := NewQueue(Options{})
+	done := q.Limit(make(chan int))
+
+	res := make(chan error)
+	go func() { res <- q.Admit(context.Background()) }()
+	waitDemand(q, 1)
+
+	asrt.NoError(q.Close())
+	asrt.Equal(limio.ErrClosed, <-res)
+	asrt.True(<-done)
+	asrt.Equal(limio.ErrClosed, q.Admit(context.Background()))
+	asrt.Equal(limio.ErrClosed, q.Close())
+}
+
+func TestQueueManaged(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := limio.NewSimpleManager()
+	defer lmr.Close()
+	lmr.SimpleLimit(1000, time.Second)
+
+	q := NewQueue(Options{})
+	defer q.Close()
+	asrt.NoError(lmr.Manage(q))
+	for q.Describe().Limited == false {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		asrt.NoError(q.Admit(context.Background()))
+	}
+}
+
+func TestCoDel(t *testing.T) {
+	asrt := assert.New(t)
+
+	cfg := CoDel{Target: 5 * time.Millisecond, Interval: 100 * time.Millisecond}
+	var c codel
+	now := time.Now()
+
+	asrt.False(c.drop(cfg, time.Millisecond, now, false), "below target")
+	asrt.False(c.drop(cfg, 10*time.Millisecond, now, false), "above target, but not for an interval")
+	asrt.False(c.drop(cfg, 10*time.Millisecond, now.Add(50*time.Millisecond), false))
+	asrt.False(c.drop(cfg, 10*time.Millisecond, now.Add(100*time.Millisecond), true), "the last in line is never shed")
+
+	asrt.False(c.drop(cfg, 10*time.Millisecond, now.Add(110*time.Millisecond), false))
+	now = now.Add(210 * time.Millisecond)
+	asrt.True(c.drop(cfg, 10*time.Millisecond, now, false), "above target for an interval")
+	asrt.False(c.drop(cfg, 10*time.Millisecond, now.Add(50*time.Millisecond), false))
+	asrt.True(c.drop(cfg, 10*time.Millisecond, now.Add(100*time.Millisecond), false))
+
+	//Drops come faster as delay persists
+	asrt.Equal(70710678*time.Nanosecond, c.dropNext.Sub(now.Add(100*time.Millisecond)))
+
+	asrt.False(c.drop(cfg, time.Millisecond, now.Add(110*time.Millisecond), false))
+	asrt.False(c.dropping)
+}
+
+func TestQueueCoDel(t *testing.T) {
+	asrt := assert.New(t)
+
+	q := NewQueue(Options{CoDel: &CoDel{Target: 5 * time.Millisecond, Interval: 100 * time.Millisecond}})
+	defer q.Close()
+	q.Limit(make(chan int))
+
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	res := make(chan error, 3)
+	for i := 1; i <= 3; i++ {
+		go func() { res <- q.Admit(context.Background()) }()
+		waitDemand(q, i)
+	}
+
+	//Delay first goes over target, then stays over it for an interval
+	now = now.Add(10 * time.Millisecond)
+	q.put(1)
+	asrt.NoError(<-res)
+	now = now.Add(100 * time.Millisecond)
+	q.put(1)
+
+	//One is shed and the last in line admitted
+	e1, e2 := <-res, <-res
+	if e1 == nil {
+		e1, e2 = e2, e1
+	}
+	asrt.ErrorIs(e1, ErrShed)
+	asrt.NoError(e2)
+}
+
+func TestWrap(t *testing.T) {
+	asrt := assert.New(t)
+
+	q := NewQueue(Options{MaxQueue: 1})
+	defer q.Close()
+	q.Limit(make(chan int))
+
+	h := q.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	first := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		first <- w.Code
+	}()
+	waitDemand(q, 1)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	asrt.Equal(http.StatusTooManyRequests, w.Code)
+	asrt.Equal("1", w.Header().Get("Retry-After"))
+
+	q.put(1)
+	asrt.Equal(http.StatusNoContent, <-first)
+
+	q.Close()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	asrt.Equal(http.StatusServiceUnavailable, w.Code)
+}
+
+func TestQueueRelimit(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := limio.NewSimpleManager()
+	defer lmr.Close()
+
+	q := NewQueue(Options{})
+	defer q.Close()
+	asrt.NoError(lmr.Manage(q))
+
+	//Each new limit closes the channel the Queue was limited with before,
+	//which must not unlimit it again
+	for i := 0; i < 50; i++ {
+		lmr.SimpleLimit(1000+i, time.Second)
+		deadline := time.Now().Add(time.Second)
+		for !q.Describe().Limited && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	asrt.True(q.Describe().Limited)
+}
@@ -0,0 +1,184 @@
+package httplimit
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"astuart.co/limio"
+)
+
+//HeaderStyle selects which rate limit headers a RateLimiter writes. Styles may
+//be combined with |.
+type HeaderStyle int
+
+const (
+	//DraftHeaders are RateLimit-Limit, RateLimit-Remaining and
+	//RateLimit-Reset from the IETF httpapi rate limit headers draft, with
+	//RateLimit-Reset in seconds from now.
+	DraftHeaders HeaderStyle = 1 << iota
+
+	//LegacyHeaders are X-RateLimit-Limit, X-RateLimit-Remaining and
+	//X-RateLimit-Reset, with X-RateLimit-Reset as a Unix time in seconds.
+	LegacyHeaders
+)
+
+//A RateLimiter is middleware that limits requests per key, such as per client
+//address, with a limio.Algorithm for each key. Every response carries rate
+//limit headers derived from the live state of the key's Algorithm, and
+//requests over the limit are answered with 429 Too Many Requests and a
+//Retry-After header.
+//
+//Headers are only written for Algorithms that are limio.QuotaReporters, as all
+//of those in limio are. Keys whose Algorithm is a QuotaReporter are forgotten
+//once their whole allowance has been restored.
+//
+//A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	//Key returns the key a request is limited by. Nil means the IP address
+	//of the client.
+	Key func(*http.Request) string
+
+	//Headers selects the headers written. Zero means DraftHeaders.
+	Headers HeaderStyle
+
+	newAlg func() limio.Algorithm
+
+	mu      sync.Mutex
+	algs    map[string]limio.Algorithm
+	sweepAt int
+
+	now func() time.Time
+}
+
+//minSweep is the fewest keys a RateLimiter holds before forgetting idle ones.
+const minSweep = 64
+
+//NewRateLimiter returns a RateLimiter that calls newAlg to create the
+//Algorithm for each new key, for example
+//
+//	NewRateLimiter(func() limio.Algorithm { return limio.NewGCRA(10, time.Second, 20) })
+func NewRateLimiter(newAlg func() limio.Algorithm) *RateLimiter {
+	return &RateLimiter{
+		newAlg:  newAlg,
+		algs:    map[string]limio.Algorithm{},
+		sweepAt: minSweep,
+		now:     time.Now,
+	}
+}
+
+//Quota returns the live Quota of key, or false if key is not being limited
+//or its Algorithm is not a limio.QuotaReporter.
+func (rl *RateLimiter) Quota(key string) (limio.Quota, bool) {
+	rl.mu.Lock()
+	a, ok := rl.algs[key]
+	rl.mu.Unlock()
+
+	qr, isQR := a.(limio.QuotaReporter)
+	if !ok || !isQR {
+		return limio.Quota{}, false
+	}
+	return qr.Quota(rl.now()), true
+}
+
+//Wrap returns middleware that limits requests to next.
+func (rl *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := rl.get(rl.key(r))
+
+		now := rl.now()
+		ok, wait := a.AllowN(now, 1)
+		if qr, isQR := a.(limio.QuotaReporter); isQR {
+			rl.writeHeaders(w.Header(), qr.Quota(now), now)
+		}
+
+		if !ok {
+			if wait < 0 {
+				//Never allowed; the best we can say is to try again later
+				wait = time.Second
+			}
+			tooManyRequests(w, "rate limit exceeded", wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *RateLimiter) key(r *http.Request) string {
+	if rl.Key != nil {
+		return rl.Key(r)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func (rl *RateLimiter) get(key string) limio.Algorithm {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if a, ok := rl.algs[key]; ok {
+		return a
+	}
+
+	if len(rl.algs) >= rl.sweepAt {
+		rl.sweep()
+	}
+	a := rl.newAlg()
+	rl.algs[key] = a
+	return a
+}
+
+//NOTE must ONLY be called with mu held.
+//sweep forgets keys whose whole allowance has been restored, since a new
+//Algorithm would be in the same state.
+func (rl *RateLimiter) sweep() {
+	now := rl.now()
+	for k, a := range rl.algs {
+		qr, ok := a.(limio.QuotaReporter)
+		if !ok {
+			continue
+		}
+		if q := qr.Quota(now); q.Remaining == q.Limit && q.Reset <= 0 {
+			delete(rl.algs, k)
+		}
+	}
+	rl.sweepAt = max(2*len(rl.algs), minSweep)
+}
+
+func (rl *RateLimiter) writeHeaders(h http.Header, q limio.Quota, now time.Time) {
+	style := rl.Headers
+	if style == 0 {
+		style = DraftHeaders
+	}
+
+	reset := int(math.Ceil(q.Reset.Seconds()))
+	if style&DraftHeaders != 0 {
+		h.Set("RateLimit-Limit", strconv.Itoa(q.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(q.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	}
+	if style&LegacyHeaders != 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(q.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(q.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(now.Unix()+int64(reset), 10))
+	}
+}
+
+//tooManyRequests writes the 429 response shared by all httplimit middleware: a
+//Retry-After header and a JSON body giving the reason and the same delay.
+func tooManyRequests(w http.ResponseWriter, reason string, after time.Duration) {
+	secs := retryAfter(after)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(struct {
+		Error      string `json:"error"`
+		RetryAfter int    `json:"retry_after"`
+	}{reason, secs})
+}
@@ -0,0 +1,86 @@
+package httplimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"astuart.co/limio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	asrt := assert.New(t)
+
+	rl := NewRateLimiter(func() limio.Algorithm { return limio.NewGCRA(1, time.Second, 2) })
+	rl.Headers = DraftHeaders | LegacyHeaders
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+
+	h := rl.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("10.0.0.1:1234")
+	asrt.Equal(http.StatusNoContent, w.Code)
+	asrt.Equal("2", w.Header().Get("RateLimit-Limit"))
+	asrt.Equal("1", w.Header().Get("RateLimit-Remaining"))
+	asrt.Equal("1", w.Header().Get("RateLimit-Reset"))
+	asrt.Equal("2", w.Header().Get("X-RateLimit-Limit"))
+	asrt.Equal(strconv.FormatInt(now.Unix()+1, 10), w.Header().Get("X-RateLimit-Reset"))
+
+	w = get("10.0.0.1:1235")
+	asrt.Equal(http.StatusNoContent, w.Code)
+	asrt.Equal("0", w.Header().Get("RateLimit-Remaining"))
+
+	//Over the limit
+	w = get("10.0.0.1:1236")
+	asrt.Equal(http.StatusTooManyRequests, w.Code)
+	asrt.Equal("1", w.Header().Get("Retry-After"))
+	asrt.Equal("0", w.Header().Get("RateLimit-Remaining"))
+
+	var body struct {
+		Error      string `json:"error"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	asrt.NoError(json.NewDecoder(w.Body).Decode(&body))
+	asrt.Equal("rate limit exceeded", body.Error)
+	asrt.Equal(1, body.RetryAfter)
+
+	//Other clients have their own limit
+	asrt.Equal(http.StatusNoContent, get("10.0.0.2:1234").Code)
+
+	q, ok := rl.Quota("10.0.0.1")
+	asrt.True(ok)
+	asrt.Equal(limio.Quota{Limit: 2, Remaining: 0, Reset: 2 * time.Second}, q)
+	_, ok = rl.Quota("10.0.0.3")
+	asrt.False(ok)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	asrt := assert.New(t)
+
+	rl := NewRateLimiter(func() limio.Algorithm { return limio.NewGCRA(1, time.Second, 1) })
+	rl.Key = func(r *http.Request) string { return r.URL.Path }
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < minSweep; i++ {
+		rl.get(strconv.Itoa(i)).AllowN(now, 1)
+	}
+
+	//Once their allowance is restored, idle keys are forgotten
+	now = now.Add(time.Second)
+	rl.get("new")
+	asrt.Len(rl.algs, 1)
+}
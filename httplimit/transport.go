@@ -0,0 +1,172 @@
+package httplimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//maxDrain is the most of a 429 response body a Transport reads before
+//retrying, so that the connection can be reused.
+const maxDrain = 4 * 1024
+
+//A Transport is an http.RoundTripper that throttles itself according to the
+//rate limit headers of the responses it receives. Once a host reports that no
+//requests remain, in either the draft (RateLimit-*) or legacy (X-RateLimit-*)
+//style, or answers with a Retry-After header, further requests to that host
+//wait until the limit resets.
+//
+//A Transport is safe for concurrent use.
+type Transport struct {
+	//Base makes the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+
+	//MaxRetries is how many times a request answered with 429 Too Many
+	//Requests is retried, after waiting as the response asked. Requests with
+	//a body are only retried if their GetBody is set.
+	MaxRetries int
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+//RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for try := 0; ; try++ {
+		if err := t.wait(req.Context(), req.URL.Host); err != nil {
+			return nil, err
+		}
+
+		resp, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.observe(req.URL.Host, resp, time.Now())
+
+		if resp.StatusCode != http.StatusTooManyRequests || try >= t.MaxRetries {
+			return resp, nil
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		io.CopyN(io.Discard, resp.Body, maxDrain)
+		resp.Body.Close()
+	}
+}
+
+//Until returns when requests to host may next be made.
+func (t *Transport) Until(host string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.until[host]
+}
+
+//wait blocks until requests to host may be made or ctx is done.
+func (t *Transport) wait(ctx context.Context, host string) error {
+	d := time.Until(t.Until(host))
+	if d <= 0 {
+		return nil
+	}
+
+	tm := time.NewTimer(d)
+	defer tm.Stop()
+
+	select {
+	case <-tm.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//observe holds back requests to host as resp asks.
+func (t *Transport) observe(host string, resp *http.Response, now time.Time) {
+	var until time.Time
+	later := func(u time.Time) {
+		if u.After(until) {
+			until = u
+		}
+	}
+
+	h := resp.Header
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if u, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+			later(u)
+		}
+	}
+
+	if headerInt(h, "RateLimit-Remaining") == 0 {
+		if secs := headerInt(h, "RateLimit-Reset"); secs > 0 {
+			later(now.Add(time.Duration(secs) * time.Second))
+		}
+	}
+
+	if headerInt(h, "X-RateLimit-Remaining") == 0 {
+		if v := headerInt(h, "X-RateLimit-Reset"); v > 0 {
+			//Usually a Unix time, but some servers send seconds from now
+			if v < now.Unix()/2 {
+				v += now.Unix()
+			}
+			later(time.Unix(v, 0))
+		}
+	}
+
+	if until.IsZero() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.until == nil {
+		t.until = map[string]time.Time{}
+	}
+	if until.After(t.until[host]) {
+		t.until[host] = until
+	}
+}
+
+//headerInt returns the integer value of header k, or -1 if it is missing or
+//not an integer.
+func headerInt(h http.Header, k string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(h.Get(k)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+//parseRetryAfter parses a Retry-After header given either in seconds or as an
+//HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
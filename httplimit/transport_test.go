@@ -0,0 +1,77 @@
+package httplimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportObserve(t *testing.T) {
+	asrt := assert.New(t)
+
+	tr := &Transport{}
+	now := time.Now().Truncate(time.Second)
+	resp := func(code int, kv ...string) *http.Response {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return &http.Response{StatusCode: code, Header: h}
+	}
+
+	tr.observe("a", resp(200, "RateLimit-Remaining", "1", "RateLimit-Reset", "5"), now)
+	asrt.True(tr.Until("a").IsZero(), "requests remain")
+
+	tr.observe("a", resp(200, "RateLimit-Remaining", "0", "RateLimit-Reset", "5"), now)
+	asrt.Equal(now.Add(5*time.Second), tr.Until("a"))
+
+	tr.observe("b", resp(200, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.Unix()+7, 10)), now)
+	asrt.Equal(now.Add(7*time.Second), tr.Until("b"))
+	tr.observe("c", resp(200, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "3"), now)
+	asrt.Equal(now.Add(3*time.Second), tr.Until("c"))
+
+	tr.observe("d", resp(429, "Retry-After", "2"), now)
+	asrt.Equal(now.Add(2*time.Second), tr.Until("d"))
+	tr.observe("e", resp(503, "Retry-After", now.Add(4*time.Second).UTC().Format(http.TimeFormat)), now)
+	asrt.Equal(now.Add(4*time.Second).Unix(), tr.Until("e").Unix())
+
+	//Limits never move earlier
+	tr.observe("a", resp(429, "Retry-After", "1"), now)
+	asrt.Equal(now.Add(5*time.Second), tr.Until("a"))
+}
+
+func TestTransportRetry(t *testing.T) {
+	asrt := assert.New(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: &Transport{MaxRetries: 1}}
+	resp, err := c.Post(srv.URL, "text/plain", strings.NewReader("hi"))
+	asrt.NoError(err)
+	resp.Body.Close()
+	asrt.Equal(http.StatusNoContent, resp.StatusCode)
+	asrt.Equal(2, calls)
+
+	//Without retries the 429 is returned
+	calls = 0
+	c = &http.Client{Transport: &Transport{}}
+	resp, err = c.Get(srv.URL)
+	asrt.NoError(err)
+	resp.Body.Close()
+	asrt.Equal(http.StatusTooManyRequests, resp.StatusCode)
+}
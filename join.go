@@ -0,0 +1,312 @@
+package limio
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+//A Join lets a single Limiter be governed by several limits at once, such as
+//a per-connection cap, a per-tenant cap and a global cap. Each governing
+//Manager (or caller) limits its own source, obtained from Parent, and the
+//Join only passes tokens on to the underlying Limiter once every limited
+//source has granted them, so the limits combine as a minimum. Sources that
+//are unlimited impose no constraint; if every source is unlimited, so is the
+//underlying Limiter.
+//
+//Tokens a source grants beyond what the others allow are kept for a while,
+//but never more than twice that source's latest grant, so a loose limit
+//cannot build up a burst behind a tight one.
+//
+//A Join is safe for concurrent use.
+type Join struct {
+	l Limiter
+
+	newSource chan chan *joinSource
+	setLimit  chan *joinLimit
+	grant     chan joinGrant
+	describe  chan describeRequest
+	cls       chan struct{}
+	closed    chan struct{}
+}
+
+//joinSource is one of the limits governing a Join.
+type joinSource struct {
+	j *Join
+}
+
+type joinLimit struct {
+	s    *joinSource
+	lim  <-chan int
+	done chan<- bool
+
+	//ready is closed once run() has applied the limit.
+	ready chan struct{}
+}
+
+type joinGrant struct {
+	s    *joinSource
+	stop chan struct{}
+	n    int
+	ok   bool
+}
+
+//sourceState is owned by run().
+type sourceState struct {
+	limited bool
+	balance int
+	done    chan<- bool
+	stop    chan struct{}
+}
+
+//NewJoin returns a Join governing l. l is unlimited until one of the Join's
+//sources is limited.
+func NewJoin(l Limiter) *Join {
+	j := &Join{
+		l:         l,
+		newSource: make(chan chan *joinSource),
+		setLimit:  make(chan *joinLimit),
+		grant:     make(chan joinGrant),
+		describe:  make(chan describeRequest),
+		cls:       make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+//All governs l by every one of the given Managers at once, returning the Join
+//that combines them.
+func All(l Limiter, ms ...Manager) (*Join, error) {
+	j := NewJoin(l)
+	for _, m := range ms {
+		if err := m.Manage(j.Parent()); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+//Parent returns a new source for the Join: a Limiter that can be limited
+//independently of the Join's other sources, typically by being managed.
+func (j *Join) Parent() Limiter {
+	reply := make(chan *joinSource)
+	select {
+	case j.newSource <- reply:
+		return <-reply
+	case <-j.closed:
+		return &joinSource{j: j}
+	}
+}
+
+//Close stops the Join, unlimiting the underlying Limiter and letting the
+//owners of every source know that it has shut down. The Join also shuts down
+//by itself if the underlying Limiter does.
+func (j *Join) Close() error {
+	select {
+	case j.cls <- struct{}{}:
+	case <-j.closed:
+	}
+	<-j.closed
+	return nil
+}
+
+//Limit implements the limio.Limiter interface for a single source. The
+//underlying Limiter is limited accordingly before Limit returns.
+func (s *joinSource) Limit(ch chan int) <-chan bool {
+	done := make(chan bool, 1)
+	if !s.setLimit(&joinLimit{s: s, lim: ch, done: done}) {
+		done <- true
+	}
+	return done
+}
+
+//Unlimit implements the limio.Limiter interface for a single source.
+func (s *joinSource) Unlimit() {
+	s.setLimit(&joinLimit{s: s})
+}
+
+//setLimit hands l to run() and waits for it to be applied, returning false
+//if the Join is closed.
+func (s *joinSource) setLimit(l *joinLimit) bool {
+	l.ready = make(chan struct{})
+	select {
+	case s.j.setLimit <- l:
+		<-l.ready
+		return true
+	case <-s.j.closed:
+		return false
+	}
+}
+
+//Describe implements the limio.Describer interface, describing the Limiter
+//governed by the Join.
+func (s *joinSource) Describe() Snapshot {
+	return s.describeTree(describing{})
+}
+
+func (s *joinSource) describeTree(path describing) Snapshot {
+	//Keyed by the Join, as run can only describe for one source at a time
+	if !path.enter(s.j) {
+		return Snapshot{Kind: fmt.Sprintf("%T", s.j.l), Cycle: true}
+	}
+	defer delete(path, s.j)
+
+	reply := make(chan Snapshot)
+	select {
+	case s.j.describe <- describeRequest{path, reply}:
+		return <-reply
+	case <-s.j.closed:
+		return path.describe(s.j.l)
+	}
+}
+
+//describeRequest asks run for the Snapshot of the Join's Limiter.
+type describeRequest struct {
+	path  describing
+	reply chan<- Snapshot
+}
+
+func (j *Join) run() {
+	sources := map[*joinSource]*sourceState{}
+	var out chan int
+	var childDone <-chan bool
+
+	//available returns how many tokens every limited source has granted.
+	available := func() int {
+		n := -1
+		for _, st := range sources {
+			if st.limited && (n < 0 || st.balance < n) {
+				n = st.balance
+			}
+		}
+		return n
+	}
+
+	//update limits or unlimits the underlying Limiter to match the sources.
+	update := func() {
+		if available() < 0 {
+			if out != nil {
+				out, childDone = nil, nil
+				j.l.Unlimit()
+			}
+			return
+		}
+		if out == nil {
+			out = make(chan int)
+			childDone = j.l.Limit(out)
+		}
+	}
+
+	for {
+		var send chan int
+		n := available()
+		if n > 0 {
+			send = out
+		}
+
+		select {
+		case send <- n:
+			for _, st := range sources {
+				if st.limited {
+					st.balance -= n
+				}
+			}
+		case reply := <-j.newSource:
+			s := &joinSource{j: j}
+			sources[s] = &sourceState{}
+			reply <- s
+		case l := <-j.setLimit:
+			st, ok := sources[l.s]
+			if !ok {
+				//A source handed out after the Join was closed
+				notify(l.done, true)
+				close(l.ready)
+				continue
+			}
+			if st.stop != nil {
+				close(st.stop)
+				st.stop = nil
+			}
+			notify(st.done, false)
+			*st = sourceState{}
+
+			if l.lim != nil {
+				st.limited = true
+				st.done = l.done
+				st.stop = make(chan struct{})
+				go j.forward(l.s, l.lim, st.stop)
+			}
+			update()
+			close(l.ready)
+		case g := <-j.grant:
+			st := sources[g.s]
+			if st == nil || st.stop != g.stop {
+				//A stale grant from a limit that has since been replaced
+				continue
+			}
+			if !g.ok {
+				glog.V(5).Info("Join source limit channel closed; unlimiting it")
+				notify(st.done, false)
+				*st = sourceState{}
+				update()
+				continue
+			}
+			st.balance += g.n
+			if g.n > 0 && st.balance > 2*g.n {
+				st.balance = 2 * g.n
+			}
+		case fin := <-childDone:
+			childDone = nil
+			if fin {
+				glog.V(5).Info("Joined Limiter shut down; closing Join")
+				j.shutdown(sources, false)
+				return
+			}
+		case req := <-j.describe:
+			s := req.path.describe(j.l)
+			s.Limited = out != nil
+			req.reply <- s
+		case <-j.cls:
+			j.shutdown(sources, out != nil)
+			return
+		}
+	}
+}
+
+//shutdown must only be called from run().
+func (j *Join) shutdown(sources map[*joinSource]*sourceState, unlimit bool) {
+	for _, st := range sources {
+		if st.stop != nil {
+			close(st.stop)
+		}
+		notify(st.done, true)
+	}
+	if unlimit {
+		j.l.Unlimit()
+	}
+	close(j.closed)
+}
+
+//forward passes grants from a source's limit channel to run() until stop is
+//closed.
+func (j *Join) forward(s *joinSource, lim <-chan int, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case n, ok := <-lim:
+			select {
+			case j.grant <- joinGrant{s: s, stop: stop, n: n, ok: ok}:
+			case <-stop:
+				return
+			case <-j.closed:
+				return
+			}
+			if !ok {
+				return
+			}
+		}
+	}
+}
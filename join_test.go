@@ -0,0 +1,81 @@
+package limio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoin(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+
+	j := NewJoin(r)
+	defer j.Close()
+
+	a, b := j.Parent(), j.Parent()
+	ca, cb := make(chan int, 1), make(chan int, 1)
+	a.Limit(ca)
+	b.Limit(cb)
+
+	p := make([]byte, 100)
+
+	ca <- 100
+	cb <- 30
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(30, n, "the tighter source should win")
+
+	cb <- 100
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(70, n, "the rest of the looser source's grant should be kept")
+
+	a.Unlimit()
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(30, n, "an unlimited source should impose no constraint")
+
+	cb <- 40
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(40, n)
+
+	b.Unlimit()
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(100, n)
+	asrt.False(Describe(a).Limited)
+}
+
+func TestAll(t *testing.T) {
+	asrt := assert.New(t)
+
+	m1, m2 := NewSimpleManager(), NewSimpleManager()
+	c1, c2 := make(chan int, 1), make(chan int, 1)
+	m1.Limit(c1)
+	m2.Limit(c2)
+
+	r := NewReader(strings.NewReader(testText))
+
+	j, err := All(r, m1, m2)
+	asrt.NoError(err)
+	asrt.Len(m1.Describe().Children, 1)
+	asrt.Len(m2.Describe().Children, 1)
+
+	c1 <- 50
+	c2 <- 20
+
+	p := make([]byte, 100)
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(20, n)
+
+	j.Close()
+	m1.Close()
+	m2.Close()
+	r.Close()
+}
@@ -0,0 +1,327 @@
+package limio
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//LazyReader is a rate-limited io.Reader that, unlike Reader, runs no
+//background goroutine. Token availability is worked out inside Read, either
+//from a monotonic clock (SimpleLimit), from a Bucket it may share with other
+//Limiters (LimitBucket), or by receiving directly from a Limit channel. There
+//is nothing to leak if Close is never called, which makes LazyReader suited to
+//wrapping large numbers of short-lived streams.
+//
+//LazyReader implements Limiter and BucketLimiter, so it can be managed by
+//either a SimpleManager or a BucketManager. A BucketManager is the better fit:
+//a SimpleManager replaces any share a member has not yet received with the
+//next one, and a LazyReader only receives while it is blocked in Read, so
+//under a SimpleManager it gets no more than the latest share each time it
+//reads, however long it went between Reads.
+//
+//Limits may be changed concurrently with Read, but Read itself, like most
+//io.Readers, must not be called concurrently.
+type LazyReader struct {
+	r   io.Reader
+	eof bool
+
+	mu      sync.Mutex
+	lim     <-chan int
+	bucket  *Bucket
+	own     *Bucket
+	done    chan<- bool
+	changed chan struct{}
+	timeout time.Duration
+	closed  bool
+	fin     chan struct{}
+
+	name string
+	conf *Rate
+
+	allocated atomic.Int64
+	consumed  atomic.Int64
+	demand    atomic.Int64
+
+	//balance holds tokens received from lim that a short read left unspent.
+	//Only Read may access them.
+	balance    int
+	balanceFor <-chan int
+}
+
+//NewLazyReader takes any io.Reader and returns an unlimited LazyReader.
+func NewLazyReader(r io.Reader) *LazyReader {
+	return &LazyReader{
+		r:       r,
+		changed: make(chan struct{}),
+		fin:     make(chan struct{}),
+	}
+}
+
+//setLimit must be called with the lock held. It replaces the current limit,
+//notifying its owner and waking any blocked Read.
+func (r *LazyReader) setLimit(lim <-chan int, b *Bucket, conf *Rate) <-chan bool {
+	if r.closed {
+		return finished()
+	}
+
+	notify(r.done, false)
+	r.done = nil
+
+	r.lim, r.bucket, r.conf = lim, b, conf
+	close(r.changed)
+	r.changed = make(chan struct{})
+
+	if lim == nil && b == nil {
+		return nil
+	}
+
+	done := make(chan bool, 1)
+	r.done = done
+	return done
+}
+
+//Limit implements the limio.Limiter interface. Read receives its tokens
+//directly from lch.
+func (r *LazyReader) Limit(lch chan int) <-chan bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.setLimit(lch, nil, nil)
+}
+
+//LimitBucket implements the limio.BucketLimiter interface.
+func (r *LazyReader) LimitBucket(b *Bucket) <-chan bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.setLimit(nil, b, nil)
+}
+
+//SimpleLimit limits the LazyReader to n bytes per t, smoothed over
+//DefaultWindow.
+func (r *LazyReader) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return r.SimpleLimitBurst(n, t, 0)
+}
+
+//SimpleLimitBurst is like SimpleLimit, but lets up to burst bytes be read at
+//once.
+func (r *LazyReader) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return finished()
+	}
+	if r.own == nil {
+		r.own = NewBucket()
+	}
+	r.own.SetRate(n, t, burst)
+	return r.setLimit(nil, r.own, &Rate{N: n, Per: t, Burst: burst})
+}
+
+//Unlimit implements the limio.Limiter interface.
+func (r *LazyReader) Unlimit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setLimit(nil, nil, nil)
+}
+
+//SetTimeout configures Read to return ErrTimeoutExceeded if it waits longer
+//than t for tokens. A t of zero waits forever.
+func (r *LazyReader) SetTimeout(t time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	r.timeout = t
+	return nil
+}
+
+//Close notifies the owner of the current limit that the LazyReader is done
+//and removes the limit. Any Read waiting for tokens returns ErrClosed, as do
+//all later calls to Read. Since LazyReader holds no goroutines, calling Close
+//is otherwise only necessary to let a Manager know it can forget the
+//LazyReader.
+func (r *LazyReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+
+	notify(r.done, true)
+	r.done = nil
+	r.setLimit(nil, nil, nil)
+	r.closed = true
+	close(r.fin)
+	return nil
+}
+
+//Finished implements the limio.Finisher interface, returning a channel that
+//is closed once the LazyReader is closed.
+func (r *LazyReader) Finished() <-chan struct{} {
+	return r.fin
+}
+
+//Read implements io.Reader, blocking until tokens are available.
+func (r *LazyReader) Read(p []byte) (written int, err error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return 0, ErrClosed
+	}
+
+	if r.eof {
+		return 0, io.EOF
+	}
+
+	defer r.demand.Store(0)
+
+	for written < len(p) && err == nil {
+		r.demand.Store(int64(max(len(p[written:])-r.balance, 0)))
+
+		r.mu.Lock()
+		lch, b, changed, timeLimit, closed := r.lim, r.bucket, r.changed, r.timeout, r.closed
+		r.mu.Unlock()
+
+		if closed {
+			if written == 0 {
+				err = ErrClosed
+			}
+			return
+		}
+
+		want := len(p[written:])
+		lim := want
+
+		switch {
+		case b != nil:
+			lim, err = takeForRead(b, changed, want, written > 0, timeLimit)
+			if err == ErrBucketCanceled {
+				err = nil
+				continue
+			}
+			if err != nil || lim == 0 {
+				return
+			}
+			r.allocated.Add(int64(lim))
+		case lch != nil && r.balance > 0 && r.balanceFor == lch:
+			lim, r.balance = r.balance, 0
+		case lch != nil:
+			r.balance = 0
+			var ok bool
+			lim, ok, err = r.receive(lch, changed, written > 0, timeLimit)
+			if err != nil || (lim == 0 && ok && written > 0) {
+				return
+			}
+			if !ok {
+				continue
+			}
+			r.allocated.Add(int64(lim))
+		}
+
+		grant := lim
+		if lim > want {
+			lim = want
+		}
+
+		var n int
+		n, err = r.r.Read(p[written:][:lim])
+		written += n
+		r.consumed.Add(int64(n))
+
+		//Keep what a short read left unspent: tokens from a Bucket go back to
+		//it for others to use, and tokens from a channel carry over.
+		switch unused := grant - n; {
+		case unused <= 0:
+		case b != nil:
+			b.Put(unused)
+			r.allocated.Add(-int64(unused))
+		case lch != nil:
+			r.balance += unused
+			r.balanceFor = lch
+		}
+
+		if err == io.EOF {
+			r.eof = true
+		}
+	}
+	return
+}
+
+//Demand implements the limio.Demander interface. It returns the number of
+//bytes a Read in progress is still waiting to fill, or 0 if no Read is in
+//progress.
+func (r *LazyReader) Demand() int {
+	return int(r.demand.Load())
+}
+
+//receive gets a grant from lch, only waiting if nothing has been read yet.
+//ok is false if the limit changed or went away while waiting.
+func (r *LazyReader) receive(lch <-chan int, changed <-chan struct{}, wrote bool, timeLimit time.Duration) (n int, ok bool, err error) {
+	select {
+	case n, ok = <-lch:
+	default:
+		if wrote {
+			return 0, true, nil
+		}
+
+		var timeout <-chan time.Time
+		if timeLimit > 0 {
+			t := time.NewTimer(timeLimit)
+			defer t.Stop()
+			timeout = t.C
+		}
+
+		select {
+		case n, ok = <-lch:
+		case <-changed:
+			return 0, false, nil
+		case <-timeout:
+			return 0, false, ErrTimeoutExceeded
+		}
+	}
+
+	if !ok {
+		//The source of the limit has gone away, so there is nothing left to
+		//enforce.
+		r.mu.Lock()
+		if r.lim == lch {
+			r.setLimit(nil, nil, nil)
+		}
+		r.mu.Unlock()
+	}
+	return n, ok, nil
+}
+
+//SetName assigns a human-readable name to the LazyReader, used by Describe.
+func (r *LazyReader) SetName(name string) {
+	r.mu.Lock()
+	r.name = name
+	r.mu.Unlock()
+}
+
+//Describe implements the limio.Describer interface.
+func (r *LazyReader) Describe() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Snapshot{
+		Name:    r.name,
+		Kind:    "lazy-reader",
+		Limited: r.lim != nil || r.bucket != nil,
+		Stats: Stats{
+			Allocated: r.allocated.Load(),
+			Consumed:  r.consumed.Load(),
+		},
+	}
+	if r.conf != nil {
+		c := *r.conf
+		s.Rate = &c
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package limio
+
+import (
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyReaderLimit(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewLazyReader(strings.NewReader(testText))
+	asrt.Implements((*BucketLimiter)(nil), r)
+
+	c := make(chan int, 1)
+	done := r.Limit(c)
+	c <- 20
+
+	p := make([]byte, len(testText))
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(20, n)
+
+	go func() {
+		c <- 10
+		c <- 10
+	}()
+	n, err = r.Read(p[:20])
+	asrt.NoError(err)
+	asrt.Equal(20, n)
+
+	r.SetTimeout(10 * time.Millisecond)
+	_, err = r.Read(p)
+	asrt.Equal(ErrTimeoutExceeded, err)
+	r.SetTimeout(0)
+
+	//Unlimit wakes a blocked Read
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		r.Unlimit()
+	}()
+	n, err = r.Read(p)
+	asrt.Equal(io.EOF, err)
+	asrt.Equal(len(testText)-40, n)
+	asrt.False(<-done)
+
+	asrt.Equal(int64(40), r.Describe().Stats.Allocated)
+	asrt.Equal(int64(len(testText)), r.Describe().Stats.Consumed)
+}
+
+func TestLazyReaderSimpleLimit(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewLazyReader(strings.NewReader(testText))
+	r.SimpleLimitBurst(KB, time.Second, 100)
+
+	p := make([]byte, len(testText))
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(100, n)
+
+	start := time.Now()
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.True(n > 0)
+	asrt.True(time.Since(start) > 500*time.Microsecond, "second read should wait for tokens")
+
+	asrt.Equal(&Rate{N: KB, Per: time.Second, Burst: 100}, r.Describe().Rate)
+}
+
+func TestLazyReaderManaged(t *testing.T) {
+	asrt := assert.New(t)
+
+	before := runtime.NumGoroutine()
+
+	bm := NewBucketManager()
+	bm.SimpleLimitBurst(KB, time.Second, 30)
+
+	rs := make([]*LazyReader, 100)
+	for i := range rs {
+		rs[i] = NewLazyReader(strings.NewReader(testText))
+		asrt.NoError(bm.Manage(rs[i]))
+	}
+
+	//Allow for stray goroutines from other tests, but not one per reader
+	asrt.True(runtime.NumGoroutine() < before+len(rs)/2, "lazy readers should not start goroutines")
+
+	p := make([]byte, len(testText))
+	n, err := rs[0].Read(p)
+	asrt.NoError(err)
+	asrt.Equal(30, n)
+
+	bm.Close()
+
+	n, err = rs[1].Read(p)
+	asrt.NoError(err)
+	asrt.Equal(len(testText), n, "closing the manager should unlimit its members")
+}
+
+func TestLazyReaderRefund(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewLazyReader(&chunkReader{strings.NewReader(testText), 10})
+
+	c := make(chan int, 1)
+	r.Limit(c)
+	c <- 100
+
+	p := make([]byte, 25)
+	total := 0
+	for total < 100 {
+		n, err := r.Read(p)
+		asrt.NoError(err)
+		total += n
+	}
+	asrt.Equal(100, total, "every granted token should be spent")
+
+	b := NewBucket()
+	b.SetFed()
+	b.Put(100)
+	r.LimitBucket(b)
+
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(25, n)
+	asrt.Equal(75, b.TryTake(1000))
+}
+
+func TestLazyReaderClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewLazyReader(strings.NewReader(testText))
+	r.Limit(make(chan int))
+
+	read := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 10))
+		read <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	asrt.NoError(r.Close())
+	asrt.Equal(ErrClosed, <-read)
+
+	_, err := r.Read(make([]byte, 10))
+	asrt.Equal(ErrClosed, err)
+	asrt.Equal(ErrClosed, r.Close())
+	asrt.True(<-r.SimpleLimit(KB, time.Second))
+	asrt.True(<-r.LimitBucket(NewBucket()))
+}
@@ -3,6 +3,9 @@ package limio
 import (
 	"errors"
 	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -23,28 +26,117 @@ type Manager interface {
 //
 //A SimpleManager is designed so that Limit and Manage may be called
 //concurrently.
+//
+//Unlike a BucketManager, a SimpleManager pushes a share of its limit to every
+//member on every tick, since that is what lets it divide the limit by weight,
+//demand, deficit or deadline. Each member is fed from a goroutine of its own,
+//so one that is slow to receive never holds up the rest.
+//
+//Closing a SimpleManager unlimits every managed Limiter. Afterwards Manage
+//and SetWeight return ErrClosed, and further limits are ignored.
 type SimpleManager struct {
-	m map[Limiter]chan int
+	m      map[Limiter]chan int
+	w      map[Limiter]int
+	joined map[Limiter]time.Time
+
+	//feeds holds, for each limited member, the feed passing its grants on
+	//to the channel it was limited with.
+	feeds map[Limiter]*feed
+
+	//watched holds, for each member that is a Finisher, a channel closed to
+	//stop watching it once it is no longer managed.
+	watched map[Limiter]chan struct{}
 
 	newLimit chan *limit
-	cls      chan struct{}
+
+	clsOnce *sync.Once
+	closed  chan struct{}
+	stopped chan struct{}
+
+	closingOnce *sync.Once
+	closing     chan struct{}
+	drained     chan chan struct{}
 
 	newLimiter chan Limiter
 	clsLimiter chan Limiter
+	describe   chan chan managerState
+	newWeight  chan *weight
+
+	infoM     *sync.Mutex
+	name      string
+	conf      *Rate
+	slowStart Ramp
+
+	allocated atomic.Int64
+	consumed  atomic.Int64
+
+	//refunded holds tokens given back by RefundLimiters, to be handed out
+	//again in the next distribution.
+	refunded atomic.Int64
+
+	//empty is closed, when run() owns it, once there are no managed
+	//Limiters left.
+	empty []chan struct{}
+
+	//byDemand selects demand-proportional distribution (see DemandManager),
+	//in which case spare holds tokens that no member wanted last time.
+	byDemand bool
+	spare    int
+
+	//drr holds the state of deficit round robin distribution (see
+	//DRRManager), which carries spare over in the same way.
+	drr *drr
+
+	//edf holds the state of earliest deadline first distribution (see
+	//EDFManager), which also carries spare over.
+	edf *edf
+	//self is the manager wrapping the SimpleManager, such as a DRRManager, if
+	//any. It may not manage itself either.
+	self Limiter
+}
+
+type weight struct {
+	l   Limiter
+	w   int
+	err chan error
+}
+
+//managerState is a copy of the state owned by run(), used for Describe.
+type managerState struct {
+	limited  bool
+	children []Limiter
+	weights  map[Limiter]int
+	deficits map[Limiter]int
 }
 
 //NewSimpleManager creates and initializes a SimpleManager.
 func NewSimpleManager() *SimpleManager {
 	glog.V(9).Info("Creating a simple manager")
-	lm := SimpleManager{
-		m:          make(map[Limiter]chan int),
-		newLimit:   make(chan *limit),
-		cls:        make(chan struct{}),
-		newLimiter: make(chan Limiter),
-		clsLimiter: make(chan Limiter),
-	}
+	lm := newSimpleManager()
 	go lm.run()
-	return &lm
+	return lm
+}
+
+func newSimpleManager() *SimpleManager {
+	return &SimpleManager{
+		m:           make(map[Limiter]chan int),
+		w:           make(map[Limiter]int),
+		joined:      make(map[Limiter]time.Time),
+		feeds:       make(map[Limiter]*feed),
+		watched:     make(map[Limiter]chan struct{}),
+		newLimit:    make(chan *limit),
+		newLimiter:  make(chan Limiter),
+		clsLimiter:  make(chan Limiter),
+		describe:    make(chan chan managerState),
+		newWeight:   make(chan *weight),
+		infoM:       &sync.Mutex{},
+		clsOnce:     &sync.Once{},
+		closed:      make(chan struct{}),
+		stopped:     make(chan struct{}),
+		closingOnce: &sync.Once{},
+		closing:     make(chan struct{}),
+		drained:     make(chan chan struct{}),
+	}
 }
 
 //DefaultWindow is the window used to smooth SimpleLimit rates. That is,
@@ -57,24 +149,46 @@ func (lm *SimpleManager) run() {
 	limited := false
 	cl := &limit{}
 	ct := &time.Ticker{}
+	var rm *ramping
 
 	for {
 		glog.V(9).Info("SimpleManager waiting for action on a channel")
 		select {
-		case <-ct.C:
-			lm.distribute(cl.rate.n)
+		case now := <-ct.C:
+			n := cl.rate.n
+			if rm != nil {
+				n = rm.next(now, cl.rate.t)
+				if rm.done(now) {
+					rm = nil
+				}
+			}
+			lm.distribute(n)
 			glog.V(9).Info("Got tick from ticker")
-		case tot := <-cl.lim:
+		case tot, ok := <-cl.lim:
+			if !ok {
+				//The source of the limit has gone away (e.g. we were
+				//unmanaged), so there is nothing left to enforce.
+				glog.V(5).Info("Limit channel closed; unlimiting")
+				notify(cl.done, false)
+				cl, rm = &limit{}, nil
+				limited = false
+				for l := range lm.m {
+					l.Unlimit()
+					lm.unfeed(l)
+				}
+				continue
+			}
 			lm.distribute(tot)
 			glog.V(9).Infof("Got new input on limit channel: %d", tot)
 		case newLim := <-lm.newLimit:
 			glog.V(5).Infof("Got a new limit: %#v", newLim)
 
 			notify(cl.done, false)
-			cl = &limit{}
+			prev, prm := cl, rm
+			cl, rm = &limit{}, nil
 			ct.Stop()
 
-			if newLim != nil {
+			if !newLim.unlimited() {
 				limited = true
 				cl = newLim
 
@@ -83,8 +197,9 @@ func (lm *SimpleManager) run() {
 				}
 
 				if newLim.rate != (rate{}) && cl.rate.n > 0 {
-					cl.rate.n, cl.rate.t = Distribute(cl.rate.n, cl.rate.t, DefaultWindow)
+					cl.rate.n, cl.rate.t = Distribute(cl.rate.n, cl.rate.t, cl.window)
 					ct = time.NewTicker(cl.rate.t)
+					rm = startRamp(prev, prm, cl, time.Now())
 				}
 				close(newLim.ready)
 				continue
@@ -93,25 +208,63 @@ func (lm *SimpleManager) run() {
 			limited = false
 			for l := range lm.m {
 				l.Unlimit()
+				lm.unfeed(l)
 			}
+			close(newLim.ready)
 		case l := <-lm.newLimiter:
+			if _, ok := lm.m[l]; !ok {
+				lm.joined[l] = time.Now()
+				if lm.drr != nil {
+					lm.drr.add(l)
+				}
+				lm.watch(l)
+			}
 			if limited {
 				lm.limit(l)
 			} else {
+				//Remember unlimited members so they are limited along with
+				//the rest of the group once a limit is set. Only Finishers
+				//can tell us if they shut down in the meantime.
 				l.Unlimit()
-				delete(lm.m, l)
+				lm.m[l] = nil
+			}
+		case reply := <-lm.describe:
+			st := managerState{limited: limited, weights: map[Limiter]int{}}
+			for l := range lm.m {
+				st.children = append(st.children, l)
+				st.weights[l] = lm.weight(l)
+			}
+			if lm.drr != nil {
+				st.deficits = make(map[Limiter]int, len(lm.drr.deficit))
+				for l, d := range lm.drr.deficit {
+					st.deficits[l] = d
+				}
+			}
+			reply <- st
+		case w := <-lm.newWeight:
+			if _, ok := lm.m[w.l]; !ok {
+				w.err <- ErrNotManaged
+				continue
 			}
+			lm.w[w.l] = w.w
+			w.err <- nil
 		case toClose := <-lm.clsLimiter:
-			glog.V(9).Infof("Received request to close limiter %v", toClose)
-			// toClose.Unlimit()
-			close(lm.m[toClose])
-			delete(lm.m, toClose)
-		case <-lm.cls:
+			lm.remove(toClose)
+		case e := <-lm.drained:
+			if len(lm.m) == 0 {
+				close(e)
+				continue
+			}
+			lm.empty = append(lm.empty, e)
+		case <-lm.closed:
 			glog.V(9).Info("Closing limiter; unlimiting all channels.")
+			ct.Stop()
 			for l := range lm.m {
 				l.Unlimit()
+				lm.unfeed(l)
 			}
 			notify(cl.done, true)
+			close(lm.stopped)
 			return
 		}
 	}
@@ -120,46 +273,215 @@ func (lm *SimpleManager) run() {
 //NOTE must ONLY be used mutually exclusive with the run() goroutine for
 //concurrency safety.
 
-//func distribute(int) takes a number and iterates over each channel in the map of
-//managed Limiters, sending an evenly-distriuted limit to each "sublimiter".
-//distribute takes a number to distribute and returns the number of bytes
-//remaining
+//func distribute(int) takes a number and hands each managed Limiter a share of
+//it in proportion to its weight (evenly, by default), to its demand for a
+//DemandManager, by deficit round robin for a DRRManager, or by deadline for an
+//EDFManager. Shares are handed to each member's feed, so distribute never
+//waits on a member; whatever is left of a member's previous share, if it has
+//not received it yet, is taken back. distribute takes a number to distribute
+//and returns the number of bytes remaining
 func (lm *SimpleManager) distribute(n int) int {
-	if len(lm.m) > 0 {
-		each := n / len(lm.m)
-
-		glog.V(9).Infof("Distributing %d to each of %d channels", each, len(lm.m))
-
-		// Copy map for determinism
-		cp := map[Limiter]chan int{}
-		for k, v := range lm.m {
-			cp[k] = v
-		}
-
-		for n >= each && len(cp) > 0 {
-			for k, ch := range cp {
-				if ch != nil {
-					select {
-					case ch <- each:
-						n -= each
-						delete(cp, k)
-					default:
-						glog.V(9).Info("A channel was not ready")
-						//Skip if not ready; come back
-					}
-				}
+	lm.allocated.Add(int64(n))
+	n += int(lm.refunded.Swap(0))
+	grant := n
+
+	lm.infoM.Lock()
+	ss := lm.slowStart
+	lm.infoM.Unlock()
+
+	carry := lm.byDemand || lm.drr != nil || lm.edf != nil || ss.Over > 0
+	if carry {
+		n += lm.spare
+		lm.spare = 0
+	}
+	total := n
+	need := 0
+	defer func() { lm.consumed.Add(int64(total - n)) }()
+
+	if len(lm.feeds) > 0 {
+		//While limited, every member has a feed
+		cp := lm.m
+		sum := 0
+		for k := range cp {
+			sum += lm.weight(k)
+		}
+
+		var shares map[Limiter]int
+		switch {
+		case lm.drr != nil:
+			shares, _, need = lm.drr.shares(total, cp, lm.weight)
+		case lm.edf != nil:
+			var left int
+			var rest map[Limiter]chan int
+			shares, left, rest = lm.edf.shares(total, cp, lm.joined)
+			for k, s := range lm.demandShares(left, rest) {
+				shares[k] = s
 			}
+		case lm.byDemand:
+			shares = lm.demandShares(total, cp)
+		default:
+			shares = lm.weightedShares(total, grant, sum, cp, ss)
+		}
+
+		glog.V(9).Infof("Distributing %d across %d channels", n, len(lm.feeds))
+
+		for k, f := range lm.feeds {
+			n -= shares[k]
+			n += f.put(shares[k])
 		}
 	}
+
+	if carry {
+		//Carry over what nobody wanted, but no more than one grant's worth
+		//(or what a DRRManager's next member needs) so that an idle spell
+		//cannot build up an unbounded burst.
+		lm.spare = min(n, max(grant, need))
+	}
 	return n
 }
 
 //NOTE must ONLY be used inside of run() for concurrency safety
-//limit sets up a new channel for each limiter in the map. It then waits on the
-//newly returned bool channel so that limiters can be removed when closed.
+//weightedShares splits total among the members of cp in proportion to their
+//weights, which sum to sum. Members still in slow start (ss) get no more than
+//their ramped fraction of their share of grant, the tokens the SimpleManager
+//was just given; what they do not get goes to the members that are not in
+//slow start, or is left over if there are none.
+func (lm *SimpleManager) weightedShares(total, grant, sum int, cp map[Limiter]chan int, ss Ramp) map[Limiter]int {
+	shares := make(map[Limiter]int, len(cp))
+	if ss.Over <= 0 {
+		for k := range cp {
+			shares[k] = total * lm.weight(k) / sum
+		}
+		return shares
+	}
+
+	now := time.Now()
+	left := total
+	var full []Limiter
+	fullSum := 0
+	for k := range cp {
+		f := ss.interpolate(slowStartFloor, 1, now.Sub(lm.joined[k]))
+		if f >= 1 {
+			full = append(full, k)
+			fullSum += lm.weight(k)
+			continue
+		}
+		fair := total * lm.weight(k) / sum
+		shares[k] = min(fair, int(f*float64(grant*lm.weight(k))/float64(sum)))
+		left -= shares[k]
+	}
+	for _, k := range full {
+		shares[k] = left * lm.weight(k) / fullSum
+	}
+	return shares
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+//demandShares splits total among the members of cp in proportion to their
+//weighted demand, never giving a member more than it asked for. Members that
+//are not Demanders are assumed to want an even share of total.
+func (lm *SimpleManager) demandShares(total int, cp map[Limiter]chan int) map[Limiter]int {
+	demand := make(map[Limiter]int, len(cp))
+	sum, weighted := 0, 0
+	for k := range cp {
+		d := total / len(cp)
+		if dm, ok := k.(Demander); ok {
+			d = dm.Demand()
+		}
+		if d < 0 {
+			d = 0
+		}
+		demand[k] = d
+		sum += d
+		weighted += d * lm.weight(k)
+	}
+
+	shares := make(map[Limiter]int, len(cp))
+	for k, d := range demand {
+		if sum <= total {
+			shares[k] = d
+			continue
+		}
+		s := int(int64(total) * int64(d*lm.weight(k)) / int64(weighted))
+		if s > d {
+			s = d
+		}
+		shares[k] = s
+	}
+	return shares
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+func (lm *SimpleManager) remove(l Limiter) {
+	glog.V(9).Infof("Received request to close limiter %v", l)
+	lm.unfeed(l)
+	delete(lm.m, l)
+	delete(lm.w, l)
+	delete(lm.joined, l)
+	if stop, ok := lm.watched[l]; ok {
+		close(stop)
+		delete(lm.watched, l)
+	}
+	if lm.drr != nil {
+		lm.drr.remove(l)
+	}
+
+	if len(lm.m) == 0 {
+		for _, e := range lm.empty {
+			close(e)
+		}
+		lm.empty = nil
+	}
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+//watch unmanages l once it shuts down, if it is a Finisher, whether or not it
+//is limited at the time.
+func (lm *SimpleManager) watch(l Limiter) {
+	f, ok := l.(Finisher)
+	if !ok {
+		return
+	}
+
+	stop := make(chan struct{})
+	lm.watched[l] = stop
+	go func() {
+		select {
+		case <-f.Finished():
+			lm.Unmanage(l)
+		case <-stop:
+		case <-lm.closed:
+		}
+	}()
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+func (lm *SimpleManager) weight(l Limiter) int {
+	if w, ok := lm.w[l]; ok {
+		return w
+	}
+	return 1
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+//limit sets up a new channel and feed for each limiter in the map. It then
+//waits on the newly returned bool channel so that limiters can be removed when
+//closed.
 func (lm *SimpleManager) limit(l Limiter) {
-	lm.m[l] = make(chan int)
-	done := l.Limit(lm.m[l])
+	ch := make(chan int)
+	lm.m[l] = ch
+
+	var done <-chan bool
+	if rl, ok := l.(RefundLimiter); ok {
+		done = rl.LimitRefund(ch, lm.refund)
+	} else {
+		done = l.Limit(ch)
+	}
+
+	//Only stop the previous feed, closing its channel, once l has moved on
+	lm.unfeed(l)
+	lm.feeds[l] = newFeed(ch)
+
 	go func() {
 		//If `true` passed on channel, limiter is closed
 		if <-done {
@@ -168,6 +490,90 @@ func (lm *SimpleManager) limit(l Limiter) {
 	}()
 }
 
+//refund takes back n tokens that a member was granted but did not spend. It
+//is safe to call from any goroutine.
+func (lm *SimpleManager) refund(n int) {
+	lm.consumed.Add(-int64(n))
+	lm.refunded.Add(int64(n))
+}
+
+//NOTE must ONLY be used inside of run() for concurrency safety
+//unfeed stops the feed of l, if any, closing the channel it was limited with.
+func (lm *SimpleManager) unfeed(l Limiter) {
+	if f, ok := lm.feeds[l]; ok {
+		f.stop()
+		delete(lm.feeds, l)
+	}
+}
+
+//A feed passes grants on to a managed Limiter from its own goroutine, so
+//that run() never waits for a member to receive. It holds only the latest
+//grant: one the member has not received by the time the next is put is
+//replaced.
+type feed struct {
+	mu sync.Mutex
+	n  int
+
+	ready chan struct{}
+	done  chan struct{}
+}
+
+//newFeed starts a feed sending to ch, which it closes once stopped.
+func newFeed(ch chan<- int) *feed {
+	f := &feed{
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go f.run(ch)
+	return f
+}
+
+//put replaces the grant waiting to be received with n, returning what was
+//left of the grant it replaced.
+func (f *feed) put(n int) int {
+	f.mu.Lock()
+	old := f.n
+	f.n = n
+	f.mu.Unlock()
+
+	if n > 0 {
+		select {
+		case f.ready <- struct{}{}:
+		default:
+		}
+	}
+	return old
+}
+
+func (f *feed) stop() {
+	close(f.done)
+}
+
+func (f *feed) run(ch chan<- int) {
+	defer close(ch)
+	for {
+		select {
+		case <-f.ready:
+		case <-f.done:
+			return
+		}
+
+		f.mu.Lock()
+		n := f.n
+		f.n = 0
+		f.mu.Unlock()
+		if n == 0 {
+			continue
+		}
+
+		select {
+		case ch <- n:
+		case <-f.done:
+			return
+		}
+	}
+}
+
 //NewReader takes an io.Reader and Limits it according to its limit
 //policy/strategy
 func (lm *SimpleManager) NewReader(r io.Reader) *Reader {
@@ -179,12 +585,47 @@ func (lm *SimpleManager) NewReader(r io.Reader) *Reader {
 //SimpleLimit takes an int and time.Duration that will be distributed evenly
 //across all managed Limiters.
 func (lm *SimpleManager) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return lm.simpleLimit(Rate{N: n, Per: t})
+}
+
+//SimpleLimitBurst is like SimpleLimit, but smooths the rate into grants of at
+//most burst before they are distributed, rather than grants spread over
+//DefaultWindow.
+func (lm *SimpleManager) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	return lm.simpleLimit(Rate{N: n, Per: t, Burst: burst})
+}
+
+//SimpleLimitRamp is like SimpleLimit, but moves gradually from the current
+//rate to the new one according to ramp. If the SimpleManager was not limited
+//by a rate, the new rate applies immediately.
+func (lm *SimpleManager) SimpleLimitRamp(n int, t time.Duration, ramp Ramp) <-chan bool {
+	return lm.simpleLimitRamp(Rate{N: n, Per: t}, ramp)
+}
+
+//SetSlowStart makes newly managed Limiters start with a small fraction of
+//their share of the limit, growing to their full share according to ramp
+//(exponential ramps suit this best). The share they do not yet use goes to the
+//other managed Limiters, or if they are all still starting, is carried over
+//to the next distribution (up to one grant's worth). A zero Ramp turns slow
+//start off.
+func (lm *SimpleManager) SetSlowStart(ramp Ramp) {
+	lm.infoM.Lock()
+	lm.slowStart = ramp
+	lm.infoM.Unlock()
+}
+
+func (lm *SimpleManager) simpleLimit(rt Rate) <-chan bool {
+	return lm.simpleLimitRamp(rt, Ramp{})
+}
+
+func (lm *SimpleManager) simpleLimitRamp(rt Rate, ramp Ramp) <-chan bool {
+	lm.setConf(&rt)
 	done := make(chan bool, 1)
 	ready := make(chan struct{})
-	lm.newLimit <- &limit{
-		rate:  rate{n, t},
-		done:  done,
-		ready: ready,
+	l := newRateLimit(rt, done, ready)
+	l.ramp = ramp
+	if !lm.sendLimit(l) {
+		return finished()
 	}
 	<-ready
 	return done
@@ -192,12 +633,11 @@ func (lm *SimpleManager) SimpleLimit(n int, t time.Duration) <-chan bool {
 
 //Limit implements the limio.Limiter interface.
 func (lm *SimpleManager) Limit(l chan int) <-chan bool {
+	lm.setConf(nil)
 	done := make(chan bool, 1)
 	ready := make(chan struct{})
-	lm.newLimit <- &limit{
-		lim:   l,
-		done:  done,
-		ready: ready,
+	if !lm.sendLimit(&limit{lim: l, done: done, ready: ready}) {
+		return finished()
 	}
 	<-ready
 	return done
@@ -205,29 +645,193 @@ func (lm *SimpleManager) Limit(l chan int) <-chan bool {
 
 //Unlimit implements the limio.Limiter interface.
 func (lm *SimpleManager) Unlimit() {
-	lm.newLimit <- nil
+	lm.setConf(nil)
+	ready := make(chan struct{})
+	if lm.sendLimit(&limit{ready: ready}) {
+		<-ready
+	}
+}
+
+//sendLimit hands l to run(), returning false if the SimpleManager is closed.
+func (lm *SimpleManager) sendLimit(l *limit) bool {
+	select {
+	case lm.newLimit <- l:
+		return true
+	case <-lm.closed:
+		return false
+	}
+}
+
+//state returns a copy of the state owned by run(), or the zero managerState
+//if the SimpleManager is closed.
+func (lm *SimpleManager) state() managerState {
+	reply := make(chan managerState)
+	select {
+	case lm.describe <- reply:
+		return <-reply
+	case <-lm.closed:
+		return managerState{}
+	}
+}
+
+func (lm *SimpleManager) setConf(c *Rate) {
+	lm.infoM.Lock()
+	lm.conf = c
+	lm.infoM.Unlock()
+}
+
+//SetName assigns a human-readable name to the SimpleManager, used by Describe.
+func (lm *SimpleManager) SetName(name string) {
+	lm.infoM.Lock()
+	lm.name = name
+	lm.infoM.Unlock()
+}
+
+//Name returns the name assigned with SetName.
+func (lm *SimpleManager) Name() string {
+	lm.infoM.Lock()
+	defer lm.infoM.Unlock()
+	return lm.name
+}
+
+//Describe implements the limio.Describer interface. Managed Limiters are
+//described recursively, so Describe on the root of a hierarchy returns the
+//whole tree.
+func (lm *SimpleManager) Describe() Snapshot {
+	return lm.describeTree(describing{})
+}
+
+func (lm *SimpleManager) describeTree(path describing) Snapshot {
+	kind := "manager"
+	switch {
+	case lm.drr != nil:
+		kind = "drr-manager"
+	case lm.edf != nil:
+		kind = "edf-manager"
+	case lm.byDemand:
+		kind = "demand-manager"
+	}
+
+	//Wrappers such as a DRRManager are managed as themselves
+	var id Limiter = lm
+	if lm.self != nil {
+		id = lm.self
+	}
+	if !path.enter(id) {
+		return Snapshot{Kind: kind, Cycle: true}
+	}
+	defer delete(path, id)
+
+	st := lm.state()
+	lm.infoM.Lock()
+	s := Snapshot{
+		Name:    lm.name,
+		Kind:    kind,
+		Limited: st.limited,
+		Stats: Stats{
+			Allocated: lm.allocated.Load(),
+			Consumed:  lm.consumed.Load(),
+		},
+	}
+	if lm.conf != nil {
+		c := *lm.conf
+		s.Rate = &c
+	}
+	lm.infoM.Unlock()
+
+	for _, l := range st.children {
+		c := path.describe(l)
+		c.Weight = st.weights[l]
+		c.Stats.Deficit = int64(st.deficits[l])
+		s.Children = append(s.Children, c)
+	}
+	sort.SliceStable(s.Children, func(i, j int) bool {
+		return s.Children[i].Name < s.Children[j].Name
+	})
+	return s
+}
+
+//Demand implements the limio.Demander interface, returning the total demand
+//of all managed Demanders. Limiters that do not report their demand are not
+//counted.
+func (lm *SimpleManager) Demand() int {
+	st := lm.state()
+
+	n := 0
+	for _, l := range st.children {
+		if d, ok := l.(Demander); ok {
+			n += d.Demand()
+		}
+	}
+	return n
 }
 
 //Close allows the SimpleManager to free any resources it is using if the
-//consumer has no further need for the SimpleManager.
+//consumer has no further need for the SimpleManager. Every managed Limiter is
+//unlimited before Close returns, and the owner of the SimpleManager's own
+//limit is told it has shut down. Closing more than once returns ErrClosed.
 func (lm *SimpleManager) Close() error {
-	lm.cls <- struct{}{}
-	return nil
+	err := ErrClosed
+	lm.clsOnce.Do(func() {
+		close(lm.closed)
+		<-lm.stopped
+		err = nil
+	})
+	return err
+}
+
+//Finished implements the limio.Finisher interface, returning a channel that
+//is closed once the SimpleManager is closed.
+func (lm *SimpleManager) Finished() <-chan struct{} {
+	return lm.closed
 }
 
 //Unmanage allows consumers to remove a specific Limiter from its management
 //strategy
 func (lm *SimpleManager) Unmanage(l Limiter) {
-	lm.clsLimiter <- l
+	select {
+	case lm.clsLimiter <- l:
+	case <-lm.closed:
+	}
+}
+
+//ErrNotManaged is returned when an operation refers to a Limiter that is not
+//managed by the Manager.
+var ErrNotManaged = errors.New("limiter is not managed")
+
+//SetWeight sets the relative share of the SimpleManager's limit that l will
+//receive. Every managed Limiter starts with a weight of 1.
+func (lm *SimpleManager) SetWeight(l Limiter, w int) error {
+	if w < 1 {
+		return errors.New("weight must be positive")
+	}
+
+	err := make(chan error)
+	select {
+	case lm.newWeight <- &weight{l: l, w: w, err: err}:
+		return <-err
+	case <-lm.closed:
+		return ErrClosed
+	}
 }
 
 //Manage takes a Limiter that will be adopted under the management policy of
 //the SimpleManager.
 func (lm *SimpleManager) Manage(l Limiter) error {
-	if l == lm {
+	if l == lm || lm.self != nil && l == lm.self {
 		return errors.New("a manager cannot manage itself.")
 	}
 
-	lm.newLimiter <- l
-	return nil
+	select {
+	case <-lm.closing:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case lm.newLimiter <- l:
+		return nil
+	case <-lm.closed:
+		return ErrClosed
+	}
 }
@@ -2,6 +2,7 @@ package limio
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"strings"
 	"sync"
@@ -170,3 +171,133 @@ func ExampleSimpleManager() {
 
 	slowCopy([]io.Writer{buf}, []io.Reader{rdr})
 }
+
+func TestSetWeight(t *testing.T) {
+	asrt := assert.New(t)
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+
+	ch := make(chan int, 1)
+	lmr.Limit(ch)
+
+	l1 := lmr.NewReader(strings.NewReader(testText))
+	l2 := lmr.NewReader(strings.NewReader(testText))
+
+	asrt.NoError(lmr.SetWeight(l1, 3))
+	asrt.Error(lmr.SetWeight(l2, 0))
+	asrt.Equal(ErrNotManaged, lmr.SetWeight(NewReader(strings.NewReader("")), 1))
+
+	ch <- 40
+
+	p := make([]byte, len(testText))
+
+	n, err := l1.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(30, n)
+
+	n, err = l2.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(10, n)
+}
+
+func TestUnmanage(t *testing.T) {
+	asrt := assert.New(t)
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+
+	lmr.Limit(make(chan int))
+
+	l := lmr.NewReader(strings.NewReader(testText))
+	defer l.Close()
+
+	lmr.Unmanage(l)
+
+	p := make([]byte, len(testText))
+	n, err := l.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(len(testText), n, "an unmanaged reader should no longer be limited")
+}
+
+func TestManagerClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	lmr.Limit(make(chan int))
+
+	l := lmr.NewReader(strings.NewReader(testText))
+	defer l.Close()
+
+	asrt.NoError(lmr.Close())
+	asrt.Equal(ErrClosed, lmr.Close())
+
+	p := make([]byte, len(testText))
+	n, err := l.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(len(testText), n, "children should be unlimited by Close")
+
+	//Nothing may panic or block after Close
+	asrt.Equal(ErrClosed, lmr.Manage(NewReader(strings.NewReader(""))))
+	asrt.Equal(ErrClosed, lmr.SetWeight(l, 2))
+	asrt.True(<-lmr.SimpleLimit(KB, time.Second))
+	asrt.True(<-lmr.Limit(make(chan int)))
+	lmr.Unlimit()
+	lmr.Unmanage(l)
+	asrt.Empty(lmr.Describe().Children)
+	asrt.Equal(0, lmr.Demand())
+}
+
+func TestManagerChildClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	lmr.SimpleLimit(MB, time.Second)
+
+	l := lmr.NewReader(strings.NewReader(testText))
+	asrt.NoError(l.Close())
+
+	//Closing the manager after its child must not panic
+	asrt.NoError(lmr.Close())
+}
+
+func TestManagerUnlimitedChildClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+
+	l := lmr.NewReader(strings.NewReader(testText))
+	asrt.Len(lmr.Describe().Children, 1)
+
+	//A member that shuts down while unlimited is forgotten all the same
+	asrt.NoError(l.Close())
+	for len(lmr.Describe().Children) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.NoError(lmr.Shutdown(context.Background(), ShutdownOptions{Drain: true}))
+}
+
+func TestManagerRelimit(t *testing.T) {
+	asrt := assert.New(t)
+
+	for _, l := range []interface {
+		Limiter
+		Describer
+	}{NewBucketManager(), NewPacer(), NewSemaphore(0)} {
+		lmr := NewSimpleManager()
+		asrt.NoError(lmr.Manage(l))
+
+		//Each new limit closes the channel the member was limited with before,
+		//which must not unlimit it again
+		for i := 0; i < 50; i++ {
+			lmr.SimpleLimit(1000+i, time.Second)
+			deadline := time.Now().Add(time.Second)
+			for !l.Describe().Limited && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		asrt.True(l.Describe().Limited, "%T", l)
+
+		lmr.Close()
+	}
+}
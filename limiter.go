@@ -22,3 +22,19 @@ type Limiter interface {
 	Limit(chan int) <-chan bool //The channel is useful for knowing that the channel has been unlimited. The boolean represents finality.
 	Unlimit()
 }
+
+//A Finisher is a Limiter that can report that it has shut down even while it
+//is unlimited, when there is no channel returned by Limit to report it on.
+//Managers use it to forget members that shut down while unlimited.
+type Finisher interface {
+	Finished() <-chan struct{}
+}
+
+//A RefundLimiter is a Limiter that can give back tokens it was granted but
+//did not spend, such as a Reader after a short read. A SimpleManager limits
+//its RefundLimiters with LimitRefund, and hands the tokens they give back to
+//refund out again in its next distribution.
+type RefundLimiter interface {
+	Limiter
+	LimitRefund(ch chan int, refund func(int)) <-chan bool
+}
@@ -0,0 +1,334 @@
+package limio
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+//Errors passed to ListenerOptions.OnReject.
+var (
+	ErrAcceptRate = errors.New("accept rate exceeded")
+	ErrIPRate     = errors.New("connection rate per IP exceeded")
+	ErrDelayed    = errors.New("too many delayed connections")
+)
+
+//ListenerOptions configure a Listener. A Rate whose N is zero does not
+//limit.
+type ListenerOptions struct {
+	//Accept limits the rate at which connections are accepted overall.
+	Accept Rate
+
+	//PerIP limits the new connections from each source IP to N per Per, with
+	//up to Burst (by default N) at once.
+	PerIP Rate
+
+	//Reject closes connections over either limit as soon as they are
+	//accepted, rather than delaying them until they are within it.
+	Reject bool
+
+	//MaxDelay, if set, closes connections that would otherwise be delayed
+	//longer than it for being over the PerIP limit.
+	MaxDelay time.Duration
+
+	//MaxDelayed caps how many connections over the PerIP limit are held open
+	//at once, in all (by default 1024); MaxDelayedPerIP caps how many from
+	//each source IP (by default 16). Connections past either cap are closed.
+	MaxDelayed      int
+	MaxDelayedPerIP int
+
+	//OnReject, if set, is called with the remote address of each connection
+	//closed for being over a limit, and ErrAcceptRate, ErrIPRate or
+	//ErrDelayed.
+	OnReject func(net.Addr, error)
+}
+
+//A Listener is a net.Listener that limits how fast new connections are
+//accepted, overall and from each source IP, to blunt floods of connections
+//that are too small for limits on bytes to help with.
+//
+//When delaying rather than rejecting, connections over the overall limit are
+//left unaccepted in the listen backlog, while those over the PerIP limit are
+//held open and handed to Accept once their source is within the limit again,
+//so that they do not hold back connections from other sources. Delayed
+//connections from each source are handed over in the order they arrived.
+//
+//A Listener is safe for concurrent use.
+type Listener struct {
+	net.Listener
+
+	opts   ListenerOptions
+	accept *Bucket
+
+	ready chan accepted
+	once  sync.Once
+
+	//ctx is canceled once the Listener is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	ips     map[string]*source
+	sweepAt int
+	delayed int
+}
+
+//source tracks the connections from one IP.
+type source struct {
+	g     *GCRA
+	queue []net.Conn //delayed connections, oldest first
+	timer *time.Timer
+}
+
+type accepted struct {
+	c   net.Conn
+	err error
+}
+
+//NewListener returns a Listener that accepts connections from l as opts
+//allow.
+func NewListener(l net.Listener, opts ListenerOptions) *Listener {
+	ln := &Listener{
+		Listener: l,
+		opts:     opts,
+		accept:   NewBucket(),
+		ready:    make(chan accepted),
+		ips:      map[string]*source{},
+		sweepAt:  minIPSweep,
+	}
+	if ln.opts.MaxDelayed <= 0 {
+		ln.opts.MaxDelayed = defaultMaxDelayed
+	}
+	if ln.opts.MaxDelayedPerIP <= 0 {
+		ln.opts.MaxDelayedPerIP = defaultMaxDelayedPerIP
+	}
+	if r := opts.Accept; r.N > 0 && r.Per > 0 {
+		ln.accept.SetRate(r.N, r.Per, r.Burst)
+	}
+	ln.ctx, ln.cancel = context.WithCancel(context.Background())
+	return ln
+}
+
+//minIPSweep is the fewest source IPs a Listener tracks before forgetting idle
+//ones.
+const minIPSweep = 64
+
+//The connections a Listener delays at once, in all and from each source IP,
+//unless ListenerOptions say otherwise.
+const (
+	defaultMaxDelayed      = 1024
+	defaultMaxDelayedPerIP = 16
+)
+
+//Accept implements net.Listener, returning the next connection within the
+//limits.
+func (ln *Listener) Accept() (net.Conn, error) {
+	ln.once.Do(func() { go ln.run() })
+
+	select {
+	case a := <-ln.ready:
+		return a.c, a.err
+	case <-ln.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+//Close implements net.Listener, also closing any connections being delayed.
+func (ln *Listener) Close() error {
+	ln.cancel()
+
+	ln.mu.Lock()
+	for _, src := range ln.ips {
+		if src.timer != nil {
+			src.timer.Stop()
+			src.timer = nil
+		}
+		for _, c := range src.queue {
+			c.Close()
+		}
+		src.queue = nil
+	}
+	ln.delayed = 0
+	ln.mu.Unlock()
+
+	return ln.Listener.Close()
+}
+
+//run accepts connections from the wrapped net.Listener until it is closed.
+func (ln *Listener) run() {
+	for {
+		if !ln.opts.Reject {
+			if _, err := ln.accept.Acquire(ln.ctx, 1); err != nil {
+				return
+			}
+		}
+
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			if !ln.deliver(accepted{err: err}) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		if ln.opts.Reject && ln.accept.TryTake(1) < 1 {
+			ln.reject(c, ErrAcceptRate)
+			continue
+		}
+		ln.admit(c)
+	}
+}
+
+//admit hands c to Accept if its source IP is within the PerIP limit, and
+//otherwise delays or rejects it.
+func (ln *Listener) admit(c net.Conn) {
+	src := ln.get(c.RemoteAddr())
+	if src == nil {
+		ln.deliver(accepted{c: c})
+		return
+	}
+
+	ln.mu.Lock()
+	if len(src.queue) == 0 {
+		if ok, _ := src.g.AllowN(time.Now(), 1); ok {
+			ln.mu.Unlock()
+			ln.deliver(accepted{c: c})
+			return
+		}
+	}
+	err := ln.delay(src, c)
+	ln.mu.Unlock()
+
+	if err != nil {
+		ln.reject(c, err)
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+//delay queues c behind the connections already delayed from its source,
+//returning the error to reject it with if it may not wait.
+func (ln *Listener) delay(src *source, c net.Conn) error {
+	if ln.ctx.Err() != nil {
+		c.Close()
+		return nil
+	}
+	if ln.opts.Reject {
+		return ErrIPRate
+	}
+
+	_, wait := src.g.AllowN(time.Now(), 1)
+	if wait < 0 {
+		return ErrIPRate
+	}
+	//Each connection ahead of c takes another emission interval
+	wait += time.Duration(len(src.queue)) * src.g.emission
+	if ln.opts.MaxDelay > 0 && wait > ln.opts.MaxDelay {
+		return ErrIPRate
+	}
+	if ln.delayed >= ln.opts.MaxDelayed || len(src.queue) >= ln.opts.MaxDelayedPerIP {
+		return ErrDelayed
+	}
+
+	src.queue = append(src.queue, c)
+	ln.delayed++
+	if src.timer == nil {
+		src.timer = time.AfterFunc(wait, func() { ln.drain(src) })
+	}
+	return nil
+}
+
+//drain hands the connections delayed from src to Accept, oldest first, for
+//as long as src is within the PerIP limit, and then waits until it is again.
+func (ln *Listener) drain(src *source) {
+	for {
+		ln.mu.Lock()
+		if len(src.queue) == 0 {
+			src.timer = nil
+			ln.mu.Unlock()
+			return
+		}
+		ok, wait := src.g.AllowN(time.Now(), 1)
+		if !ok {
+			src.timer = time.AfterFunc(wait, func() { ln.drain(src) })
+			ln.mu.Unlock()
+			return
+		}
+		c := src.queue[0]
+		src.queue[0] = nil
+		src.queue = src.queue[1:]
+		ln.delayed--
+		ln.mu.Unlock()
+
+		if !ln.deliver(accepted{c: c}) {
+			return
+		}
+	}
+}
+
+//deliver hands a to Accept, closing its connection and returning false if the
+//Listener is closed first.
+func (ln *Listener) deliver(a accepted) bool {
+	select {
+	case ln.ready <- a:
+		return true
+	case <-ln.ctx.Done():
+		if a.c != nil {
+			a.c.Close()
+		}
+		return false
+	}
+}
+
+func (ln *Listener) reject(c net.Conn, err error) {
+	c.Close()
+	if ln.opts.OnReject != nil {
+		ln.opts.OnReject(c.RemoteAddr(), err)
+	}
+}
+
+//get returns the source of connections from addr's IP, or nil if there is no
+//PerIP limit.
+func (ln *Listener) get(addr net.Addr) *source {
+	r := ln.opts.PerIP
+	if r.N <= 0 || r.Per <= 0 {
+		return nil
+	}
+
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	if src, ok := ln.ips[ip]; ok {
+		return src
+	}
+
+	if len(ln.ips) >= ln.sweepAt {
+		ln.sweep()
+	}
+	burst := r.Burst
+	if burst < 1 {
+		burst = r.N
+	}
+	src := &source{g: NewGCRA(r.N, r.Per, burst)}
+	ln.ips[ip] = src
+	return src
+}
+
+//NOTE must ONLY be called with mu held.
+//sweep forgets source IPs with no delayed connections whose whole allowance
+//has been restored.
+func (ln *Listener) sweep() {
+	now := time.Now()
+	for ip, src := range ln.ips {
+		if len(src.queue) == 0 && src.timer == nil && src.g.Quota(now).Reset <= 0 {
+			delete(ln.ips, ip)
+		}
+	}
+	ln.sweepAt = max(2*len(ln.ips), minIPSweep)
+}
@@ -0,0 +1,197 @@
+package limio
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tcpListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no loopback TCP:", err)
+	}
+	return l
+}
+
+type rejections struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *rejections) add(_ net.Addr, err error) {
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+func (r *rejections) get() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+func dialN(t *testing.T, addr net.Addr, n int) []net.Conn {
+	cs := make([]net.Conn, n)
+	for i := range cs {
+		c, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs[i] = c
+	}
+	t.Cleanup(func() {
+		for _, c := range cs {
+			c.Close()
+		}
+	})
+	return cs
+}
+
+func TestListenerRejectPerIP(t *testing.T) {
+	asrt := assert.New(t)
+
+	var rej rejections
+	ln := NewListener(tcpListener(t), ListenerOptions{
+		PerIP:    Rate{N: 2, Per: time.Hour},
+		Reject:   true,
+		OnReject: rej.add,
+	})
+	defer ln.Close()
+
+	cs := dialN(t, ln.Addr(), 3)
+	for i := 0; i < 2; i++ {
+		c, err := ln.Accept()
+		asrt.NoError(err)
+		c.Close()
+	}
+
+	//The third is closed without being handed to Accept
+	cs[2].SetReadDeadline(time.Now().Add(time.Second))
+	_, err := cs[2].Read(make([]byte, 1))
+	asrt.Equal(io.EOF, err)
+	asrt.Equal([]error{ErrIPRate}, rej.get())
+}
+
+func TestListenerRejectAccept(t *testing.T) {
+	asrt := assert.New(t)
+
+	var rej rejections
+	ln := NewListener(tcpListener(t), ListenerOptions{
+		Accept:   Rate{N: 1, Per: time.Hour, Burst: 1},
+		Reject:   true,
+		OnReject: rej.add,
+	})
+	defer ln.Close()
+
+	dialN(t, ln.Addr(), 2)
+	c, err := ln.Accept()
+	asrt.NoError(err)
+	c.Close()
+
+	for len(rej.get()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.Equal([]error{ErrAcceptRate}, rej.get())
+}
+
+func TestListenerDelay(t *testing.T) {
+	asrt := assert.New(t)
+
+	ln := NewListener(tcpListener(t), ListenerOptions{
+		PerIP: Rate{N: 1, Per: 50 * time.Millisecond},
+	})
+	defer ln.Close()
+
+	start := time.Now()
+	dialN(t, ln.Addr(), 3)
+	for i := 0; i < 3; i++ {
+		c, err := ln.Accept()
+		asrt.NoError(err)
+		c.Close()
+	}
+	asrt.InDelta(100*time.Millisecond, time.Since(start), float64(30*time.Millisecond))
+}
+
+func TestListenerMaxDelay(t *testing.T) {
+	asrt := assert.New(t)
+
+	var rej rejections
+	ln := NewListener(tcpListener(t), ListenerOptions{
+		PerIP:    Rate{N: 1, Per: time.Hour},
+		MaxDelay: time.Second,
+		OnReject: rej.add,
+	})
+	defer ln.Close()
+
+	dialN(t, ln.Addr(), 2)
+	c, err := ln.Accept()
+	asrt.NoError(err)
+	c.Close()
+
+	for len(rej.get()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.Equal([]error{ErrIPRate}, rej.get())
+}
+
+func TestListenerClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	ln := NewListener(tcpListener(t), ListenerOptions{
+		PerIP: Rate{N: 1, Per: time.Hour},
+	})
+
+	cs := dialN(t, ln.Addr(), 2)
+	c, err := ln.Accept()
+	asrt.NoError(err)
+	c.Close()
+
+	errs := make(chan error)
+	go func() {
+		_, err := ln.Accept()
+		errs <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	asrt.NoError(ln.Close())
+	asrt.Equal(net.ErrClosed, <-errs)
+
+	//The delayed connection is closed too
+	cs[1].SetReadDeadline(time.Now().Add(time.Second))
+	_, err = cs[1].Read(make([]byte, 1))
+	asrt.Equal(io.EOF, err)
+}
+
+func TestListenerMaxDelayed(t *testing.T) {
+	asrt := assert.New(t)
+
+	for _, opts := range []ListenerOptions{
+		{PerIP: Rate{N: 1, Per: time.Hour}, MaxDelayedPerIP: 1},
+		{PerIP: Rate{N: 1, Per: time.Hour}, MaxDelayedPerIP: 10, MaxDelayed: 1},
+	} {
+		var rej rejections
+		opts.OnReject = rej.add
+		ln := NewListener(tcpListener(t), opts)
+
+		cs := dialN(t, ln.Addr(), 3)
+		c, err := ln.Accept()
+		asrt.NoError(err)
+		c.Close()
+
+		//The second is held open, and the third closed
+		for len(rej.get()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		asrt.Equal([]error{ErrDelayed}, rej.get())
+		cs[2].SetReadDeadline(time.Now().Add(time.Second))
+		_, err = cs[2].Read(make([]byte, 1))
+		asrt.Equal(io.EOF, err)
+
+		ln.Close()
+	}
+}
@@ -0,0 +1,124 @@
+package netem
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+//Pipe returns the two ends of an in-memory, full-duplex stream connection,
+//like net.Pipe, with data in both directions shaped by l.
+func Pipe(l Link) (net.Conn, net.Conn) {
+	return PipeAsym(l, l)
+}
+
+//PipeAsym is like Pipe, but data written to the first conn is shaped by ab,
+//and data written to the second by ba.
+func PipeAsym(ab, ba Link) (net.Conn, net.Conn) {
+	seed := time.Now().UnixNano()
+	abl, bal := newLink(ab, false, seed), newLink(ba, false, seed+1)
+
+	a := newConn(bal, abl, Addr("a"), Addr("b"))
+	b := newConn(abl, bal, Addr("b"), Addr("a"))
+	return a, b
+}
+
+//conn is one end of a Pipe.
+type conn struct {
+	in, out       *link
+	local, remote Addr
+
+	rd, wd *deadline
+	wmu    sync.Mutex
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newConn(in, out *link, local, remote Addr) *conn {
+	return &conn{
+		in:     in,
+		out:    out,
+		local:  local,
+		remote: remote,
+		rd:     newDeadline(),
+		wd:     newDeadline(),
+		done:   make(chan struct{}),
+	}
+}
+
+//Read implements net.Conn.
+func (c *conn) Read(p []byte) (int, error) {
+	return c.in.read(p, c.done, c.rd.wait())
+}
+
+//Write implements net.Conn. It blocks while the link's bandwidth is used up,
+//sending at most one MTU at a time.
+func (c *conn) Write(b []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	deadline := c.wd.wait()
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	for len(b) > 0 {
+		seg := b
+		if len(seg) > c.out.MTU {
+			seg = seg[:c.out.MTU]
+		}
+
+		if err = c.out.pace(len(seg), c.done, deadline); err != nil {
+			return
+		}
+		if !c.out.push(seg) {
+			return n, io.ErrClosedPipe
+		}
+		n += len(seg)
+		b = b[len(seg):]
+	}
+	return
+}
+
+//Close implements net.Conn. The other end reads EOF once any data in flight
+//has arrived.
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.in.closeRead()
+		c.out.closeWrite()
+	})
+	return nil
+}
+
+//LocalAddr implements net.Conn.
+func (c *conn) LocalAddr() net.Addr { return c.local }
+
+//RemoteAddr implements net.Conn.
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+//SetDeadline implements net.Conn.
+func (c *conn) SetDeadline(t time.Time) error {
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+
+//SetReadDeadline implements net.Conn.
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.rd.set(t)
+	return nil
+}
+
+//SetWriteDeadline implements net.Conn.
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.wd.set(t)
+	return nil
+}
@@ -0,0 +1,100 @@
+package netem
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"astuart.co/limio"
+)
+
+//deadline is a channel that is closed once a deadline passes, in the manner of
+//net.Pipe.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+//set arms the deadline for t, or disarms it if t is zero.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		//Wait for the timer to finish closing cancel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+//wait returns a channel that is closed when the deadline passes.
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+//takeUntil waits for up to n tokens from b, giving up when done is closed or
+//the deadline passes.
+func takeUntil(b *limio.Bucket, n int, done, deadline <-chan struct{}) (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-done:
+		case <-deadline:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	got, err := b.Take(ctx, n)
+	if err == nil {
+		return got, nil
+	}
+
+	select {
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	default:
+		return 0, io.ErrClosedPipe
+	}
+}
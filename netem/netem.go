@@ -0,0 +1,301 @@
+//Package netem emulates slow and unreliable network links in memory, for
+//testing clients and servers inside go test without tc or netem.
+//
+//Pipe and PacketPipe work like net.Pipe, returning two connected endpoints,
+//but every byte sent is shaped by a Link: bandwidth is enforced with a
+//limio.Bucket, and each segment or packet is delayed by a one-way latency
+//plus jitter. Links may also stall at random, delivering nothing for a while,
+//and PacketConns may drop packets.
+//
+//	client, server := netem.Pipe(netem.Mobile3G)
+package netem
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"astuart.co/limio"
+)
+
+//A Link describes one direction of an emulated network link. The zero Link
+//delivers everything immediately.
+type Link struct {
+	//Bandwidth is the most bytes per second the link carries, or 0 for no
+	//limit. Burst is the most bytes that may be sent at once after the link
+	//has been idle; see limio.Bucket.SetRate for the default.
+	Bandwidth int
+	Burst     int
+
+	//Latency is the one-way delay of every segment or packet, which is
+	//randomly varied by up to Jitter either way. Stream conns never reorder
+	//data; PacketConns may.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	//Loss is the probability, from 0 to 1, that a packet is dropped. It only
+	//applies to PacketConns.
+	Loss float64
+
+	//Stall makes the link stop delivering at random.
+	Stall Stall
+
+	//MTU is the largest segment a stream conn sends at once, and so the
+	//granularity of its latency and pacing. It defaults to 1500.
+	MTU int
+
+	//Seed seeds the link's randomness. Links with the same non-zero Seed and
+	//traffic behave the same way; 0 picks a seed from the clock.
+	Seed int64
+}
+
+//A Stall describes random outages of a link. On average, once every Every
+//the link delivers nothing for For, after which everything that was held up
+//arrives at once. The zero Stall never stalls.
+type Stall struct {
+	Every time.Duration
+	For   time.Duration
+}
+
+//Some rough profiles of real links.
+var (
+	Mobile3G = Link{
+		Bandwidth: 96 * limio.KB,
+		Latency:   100 * time.Millisecond,
+		Jitter:    30 * time.Millisecond,
+		Loss:      0.01,
+		Stall:     Stall{Every: 10 * time.Second, For: 500 * time.Millisecond},
+	}
+	DSL = Link{
+		Bandwidth: 1 * limio.MB,
+		Latency:   20 * time.Millisecond,
+		Jitter:    2 * time.Millisecond,
+		Loss:      0.001,
+	}
+	Satellite = Link{
+		Bandwidth: 2 * limio.MB,
+		Latency:   300 * time.Millisecond,
+		Jitter:    10 * time.Millisecond,
+		Loss:      0.005,
+	}
+)
+
+//Addr is the net.Addr of an emulated endpoint.
+type Addr string
+
+//Network implements net.Addr.
+func (a Addr) Network() string { return "netem" }
+
+//String implements net.Addr.
+func (a Addr) String() string { return string(a) }
+
+//segment is a piece of data in flight, deliverable at a given time.
+type segment struct {
+	data []byte
+	at   time.Time
+}
+
+//link carries data in one direction.
+type link struct {
+	Link
+	bucket  *limio.Bucket
+	packets bool
+
+	mu         sync.Mutex
+	rnd        *rand.Rand
+	q          []segment
+	last       time.Time
+	stallStart time.Time
+	stallEnd   time.Time
+	wclosed    bool
+	rclosed    bool
+	changed    chan struct{}
+}
+
+func newLink(l Link, packets bool, seed int64) *link {
+	if l.MTU <= 0 {
+		l.MTU = 1500
+	}
+	if l.Seed != 0 {
+		seed = l.Seed
+	}
+
+	k := &link{
+		Link:    l,
+		bucket:  limio.NewBucket(),
+		packets: packets,
+		rnd:     rand.New(rand.NewSource(seed)),
+		changed: make(chan struct{}),
+	}
+	if l.Bandwidth > 0 {
+		k.bucket.SetRate(l.Bandwidth, time.Second, l.Burst)
+	}
+	return k
+}
+
+//signal must be called with the lock held. It wakes any blocked reader.
+func (k *link) signal() {
+	close(k.changed)
+	k.changed = make(chan struct{})
+}
+
+//deliverAt must be called with the lock held. It returns when data sent now
+//should arrive.
+func (k *link) deliverAt(now time.Time) time.Time {
+	d := k.Latency
+	if k.Jitter > 0 {
+		d += time.Duration(k.rnd.Int63n(int64(2*k.Jitter)+1)) - k.Jitter
+	}
+	if d < 0 {
+		d = 0
+	}
+	at := now.Add(d)
+
+	if k.Stall.Every > 0 && k.Stall.For > 0 {
+		if k.stallEnd.IsZero() {
+			k.nextStall(now)
+		}
+		for !at.Before(k.stallEnd) {
+			k.nextStall(k.stallEnd)
+		}
+		if !at.Before(k.stallStart) {
+			at = k.stallEnd
+		}
+	}
+
+	if !k.packets && at.Before(k.last) {
+		//Streams arrive in order
+		at = k.last
+	}
+	k.last = at
+	return at
+}
+
+//nextStall must be called with the lock held.
+func (k *link) nextStall(after time.Time) {
+	gap := time.Duration(k.rnd.ExpFloat64() * float64(k.Stall.Every))
+	k.stallStart = after.Add(gap)
+	k.stallEnd = k.stallStart.Add(k.Stall.For)
+}
+
+//push puts data in flight. It returns false if the reading end has closed.
+func (k *link) push(data []byte) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.rclosed || k.wclosed {
+		return false
+	}
+	if k.packets && k.Loss > 0 && k.rnd.Float64() < k.Loss {
+		return true
+	}
+
+	s := segment{data: append([]byte(nil), data...), at: k.deliverAt(time.Now())}
+
+	//Jittered packets may overtake those sent before them
+	i := len(k.q)
+	for i > 0 && k.q[i-1].at.After(s.at) {
+		i--
+	}
+	k.q = append(k.q, segment{})
+	copy(k.q[i+1:], k.q[i:])
+	k.q[i] = s
+
+	k.signal()
+	return true
+}
+
+//read copies delivered data into p, waiting until some has arrived. Packet
+//links return a single packet per read.
+func (k *link) read(p []byte, done, deadline <-chan struct{}) (int, error) {
+	for {
+		select {
+		case <-done:
+			return 0, io.ErrClosedPipe
+		case <-deadline:
+			return 0, os.ErrDeadlineExceeded
+		default:
+		}
+
+		k.mu.Lock()
+		now := time.Now()
+		n, ok := 0, false
+		for len(k.q) > 0 && !k.q[0].at.After(now) && n < len(p) {
+			s := &k.q[0]
+			c := copy(p[n:], s.data)
+			n += c
+			ok = true
+
+			if k.packets {
+				k.q = k.q[1:]
+				break
+			}
+			s.data = s.data[c:]
+			if len(s.data) == 0 {
+				k.q = k.q[1:]
+			}
+		}
+		if ok {
+			k.mu.Unlock()
+			return n, nil
+		}
+		if len(k.q) == 0 && k.wclosed && !k.packets {
+			k.mu.Unlock()
+			return 0, io.EOF
+		}
+
+		var t *time.Timer
+		var arrive <-chan time.Time
+		if len(k.q) > 0 {
+			t = time.NewTimer(k.q[0].at.Sub(now))
+			arrive = t.C
+		}
+		changed := k.changed
+		k.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-deadline:
+		case <-changed:
+		case <-arrive:
+		}
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
+
+//pace waits until the link has bandwidth for n bytes.
+func (k *link) pace(n int, done, deadline <-chan struct{}) error {
+	for n > 0 {
+		got := k.bucket.TryTake(n)
+		if got == 0 {
+			var err error
+			got, err = takeUntil(k.bucket, n, done, deadline)
+			if err != nil {
+				return err
+			}
+		}
+		n -= got
+	}
+	return nil
+}
+
+//closeRead stops the link accepting data, discarding anything in flight.
+func (k *link) closeRead() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.rclosed = true
+	k.q = nil
+	k.signal()
+}
+
+//closeWrite lets the reader see EOF once everything in flight has arrived.
+func (k *link) closeWrite() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.wclosed = true
+	k.signal()
+}
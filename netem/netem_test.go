@@ -0,0 +1,160 @@
+package netem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"astuart.co/limio"
+)
+
+func TestPipeLatency(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := Pipe(Link{Latency: 50 * time.Millisecond})
+	defer a.Close()
+	defer b.Close()
+
+	start := time.Now()
+	n, err := a.Write([]byte("hello"))
+	asrt.NoError(err)
+	asrt.Equal(5, n)
+
+	p := make([]byte, 10)
+	n, err = b.Read(p)
+	asrt.NoError(err)
+	asrt.Equal("hello", string(p[:n]))
+	asrt.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestPipeBandwidth(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := Pipe(Link{Bandwidth: 100 * limio.KB, Burst: limio.KB})
+	defer b.Close()
+
+	sent := bytes.Repeat([]byte("0123456789"), 2*limio.KB)
+
+	start := time.Now()
+	go func() {
+		a.Write(sent)
+		a.Close()
+	}()
+
+	got, err := io.ReadAll(b)
+	asrt.NoError(err)
+	asrt.Equal(sent, got)
+
+	//20KB at 100KB/s
+	asrt.InDelta(200*time.Millisecond, time.Since(start), float64(50*time.Millisecond))
+}
+
+func TestPipeOrder(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := Pipe(Link{Latency: 5 * time.Millisecond, Jitter: 5 * time.Millisecond, MTU: 10, Seed: 1})
+	defer b.Close()
+
+	sent := make([]byte, 1000)
+	for i := range sent {
+		sent[i] = byte(i)
+	}
+	go func() {
+		a.Write(sent)
+		a.Close()
+	}()
+
+	got, err := io.ReadAll(b)
+	asrt.NoError(err)
+	asrt.Equal(sent, got, "jitter must not reorder a stream")
+}
+
+func TestPipeClose(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := Pipe(Link{})
+
+	a.Write([]byte("bye"))
+	a.Close()
+
+	_, err := a.Write([]byte("more"))
+	asrt.Equal(io.ErrClosedPipe, err)
+
+	got, err := io.ReadAll(b)
+	asrt.NoError(err)
+	asrt.Equal("bye", string(got), "data in flight should arrive before EOF")
+
+	b.Close()
+	_, err = b.Read(make([]byte, 1))
+	asrt.Equal(io.ErrClosedPipe, err)
+}
+
+func TestPipeDeadline(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := Pipe(Link{Bandwidth: 10, Burst: 1})
+	defer a.Close()
+	defer b.Close()
+
+	b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := b.Read(make([]byte, 1))
+	asrt.True(errors.Is(err, os.ErrDeadlineExceeded))
+
+	a.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	n, err := a.Write(make([]byte, 100))
+	asrt.True(errors.Is(err, os.ErrDeadlineExceeded))
+	asrt.True(n < 100)
+}
+
+func TestPipeStall(t *testing.T) {
+	asrt := assert.New(t)
+
+	//Stall almost at once, for 30ms
+	a, b := Pipe(Link{
+		Latency: time.Millisecond,
+		Stall:   Stall{Every: time.Nanosecond, For: 30 * time.Millisecond},
+		Seed:    1,
+	})
+	defer a.Close()
+	defer b.Close()
+
+	start := time.Now()
+	a.Write([]byte("x"))
+	_, err := b.Read(make([]byte, 1))
+	asrt.NoError(err)
+	asrt.True(time.Since(start) >= 25*time.Millisecond)
+}
+
+func TestPacketPipeLoss(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := PacketPipe(Link{Loss: 0.5, Seed: 1})
+	defer a.Close()
+	defer b.Close()
+
+	for i := 0; i < 200; i++ {
+		n, err := a.WriteTo([]byte{byte(i), 1, 2}, b.LocalAddr())
+		asrt.NoError(err)
+		asrt.Equal(3, n)
+	}
+
+	got := 0
+	p := make([]byte, 2)
+	b.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	for {
+		n, addr, err := b.ReadFrom(p)
+		if err != nil {
+			asrt.True(errors.Is(err, os.ErrDeadlineExceeded))
+			break
+		}
+		asrt.Equal(2, n, "packets should be truncated to the buffer")
+		asrt.Equal(a.LocalAddr(), addr)
+		got++
+	}
+	asrt.InDelta(100, got, 40)
+}
@@ -0,0 +1,64 @@
+package netem
+
+import (
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+//PacketPipe returns two connected in-memory net.PacketConns, with packets in
+//both directions shaped by l. Packets are delivered to the other end
+//whatever address they are written to. Jitter may reorder them, and Loss
+//drops them silently, as on a real datagram network.
+func PacketPipe(l Link) (net.PacketConn, net.PacketConn) {
+	return PacketPipeAsym(l, l)
+}
+
+//PacketPipeAsym is like PacketPipe, but packets written to the first conn are
+//shaped by ab, and packets written to the second by ba.
+func PacketPipeAsym(ab, ba Link) (net.PacketConn, net.PacketConn) {
+	seed := time.Now().UnixNano()
+	abl, bal := newLink(ab, true, seed), newLink(ba, true, seed+1)
+
+	a := &packetConn{conn: newConn(bal, abl, Addr("a"), Addr("b"))}
+	b := &packetConn{conn: newConn(abl, bal, Addr("b"), Addr("a"))}
+	return a, b
+}
+
+//packetConn is one end of a PacketPipe.
+type packetConn struct {
+	*conn
+}
+
+//ReadFrom implements net.PacketConn. Packets larger than p are truncated.
+func (c *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, err := c.in.read(p, c.done, c.rd.wait())
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, c.remote, nil
+}
+
+//WriteTo implements net.PacketConn. It blocks while the link's bandwidth is
+//used up, then sends p as a single packet.
+func (c *packetConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	deadline := c.wd.wait()
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	if err := c.out.pace(len(p), c.done, deadline); err != nil {
+		return 0, err
+	}
+	//Like UDP, packets sent to a closed peer vanish
+	c.out.push(p)
+	return len(p), nil
+}
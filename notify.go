@@ -1,5 +1,14 @@
 package limio
 
+//Notify tells the owner of a limit, through the channel returned by a
+//Limiter's Limit method, that the limit is no longer in use. final reports
+//that the Limiter has shut down, in which case done is also closed. Notify
+//never blocks and ignores a nil done, so it suits Limiters implemented
+//outside this package.
+func Notify(done chan<- bool, final bool) {
+	notify(done, final)
+}
+
 func notify(n chan<- bool, v bool) {
 	if n == nil {
 		return
@@ -14,3 +23,11 @@ func notify(n chan<- bool, v bool) {
 		close(n)
 	}
 }
+
+//finished returns a channel reporting that a Limiter has already shut down,
+//for limits set after it was closed.
+func finished() <-chan bool {
+	ch := make(chan bool, 1)
+	notify(ch, true)
+	return ch
+}
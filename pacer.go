@@ -0,0 +1,340 @@
+package limio
+
+import (
+	"context"
+	"iter"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//A Pacer is a Limiter from which tokens can be acquired, for pacing work that
+//is not an io.Reader, such as items flowing through a channel or an iterator.
+//It can be limited directly with SimpleLimit or Limit, or managed by a Manager
+//such as a SimpleManager. It also implements Demander, reporting the tokens
+//being waited for, and Describer.
+//
+//A Pacer is safe for concurrent use.
+type Pacer struct {
+	b *Bucket
+
+	//ctx is canceled once the Pacer is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     *sync.Mutex
+	feed   chan struct{}
+	done   chan<- bool
+	closed bool
+	name   string
+	conf   *Rate
+
+	demand    atomic.Int64
+	allocated atomic.Int64
+	consumed  atomic.Int64
+}
+
+//NewPacer returns an unlimited Pacer.
+func NewPacer() *Pacer {
+	p := &Pacer{
+		b:  NewBucket(),
+		mu: &sync.Mutex{},
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	return p
+}
+
+//Acquire implements the limio.Acquirer interface, waiting until n tokens have
+//been granted. Tokens are spent rather than held, so the returned release
+//function does nothing. It returns ctx.Err() if ctx is done first, or
+//ErrClosed if the Pacer is closed, in which case any tokens granted are given
+//back.
+func (p *Pacer) Acquire(ctx context.Context, n int) (func(), error) {
+	if p.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	//Stop waiting for tokens if the Pacer is closed
+	tctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+	p.demand.Add(int64(n))
+	err := p.b.acquire(tctx, n, func(m int) {
+		p.demand.Add(-int64(m))
+		p.allocated.Add(int64(m))
+	})
+	stop()
+	cancel()
+
+	if err != nil {
+		p.demand.Add(-int64(n))
+		if ctx.Err() == nil {
+			err = ErrClosed
+		}
+		return nil, err
+	}
+	p.consumed.Add(int64(n))
+	return func() {}, nil
+}
+
+//SimpleLimit limits the Pacer to n tokens per t.
+func (p *Pacer) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return p.SimpleLimitBurst(n, t, 0)
+}
+
+//SimpleLimitBurst is like SimpleLimit, but lets up to burst tokens build up
+//while the Pacer is idle.
+func (p *Pacer) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return finished()
+	}
+	p.stopFeed()
+	p.b.SetRate(n, t, burst)
+	p.conf = &Rate{N: n, Per: t, Burst: burst}
+	return p.setDone()
+}
+
+//Limit implements the limio.Limiter interface. Tokens received on l are
+//granted in the order they were asked for.
+func (p *Pacer) Limit(l chan int) <-chan bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return finished()
+	}
+	p.stopFeed()
+	p.b.SetFed()
+	p.conf = nil
+
+	stop := make(chan struct{})
+	p.feed = stop
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case n, ok := <-l:
+				if !ok {
+					p.feedClosed(stop)
+					return
+				}
+				p.put(n)
+			}
+		}
+	}()
+
+	return p.setDone()
+}
+
+//put deposits n tokens received from a limit channel.
+func (p *Pacer) put(n int) {
+	if n <= 0 {
+		return
+	}
+
+	p.b.Put(n)
+	if p.demand.Load() == 0 {
+		//Nothing is waiting, so keep no more than one grant's worth for later
+		p.b.Put(min(p.b.TryTake(math.MaxInt32), n))
+	}
+}
+
+//Unlimit implements the limio.Limiter interface.
+func (p *Pacer) Unlimit() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unlimit()
+}
+
+//NOTE must ONLY be called with mu held.
+func (p *Pacer) unlimit() {
+	p.stopFeed()
+	p.b.Unlimit()
+	p.conf = nil
+	notify(p.done, false)
+	p.done = nil
+}
+
+//feedClosed unlimits p when the channel fed by stop is closed, unless a newer
+//limit has replaced it already.
+func (p *Pacer) feedClosed(stop chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.feed == stop {
+		p.unlimit()
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+func (p *Pacer) stopFeed() {
+	if p.feed != nil {
+		close(p.feed)
+		p.feed = nil
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+func (p *Pacer) setDone() <-chan bool {
+	notify(p.done, false)
+	done := make(chan bool, 1)
+	p.done = done
+	return done
+}
+
+//Demand implements the limio.Demander interface, returning the tokens being
+//waited for.
+func (p *Pacer) Demand() int {
+	return int(p.demand.Load())
+}
+
+//SetName assigns a human-readable name to the Pacer, used by Describe.
+func (p *Pacer) SetName(name string) {
+	p.mu.Lock()
+	p.name = name
+	p.mu.Unlock()
+}
+
+//Describe implements the limio.Describer interface. Allocated counts tokens
+//granted, and Consumed tokens acquired.
+func (p *Pacer) Describe() Snapshot {
+	return p.describe("pacer")
+}
+
+func (p *Pacer) describe(kind string) Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := Snapshot{
+		Name:    p.name,
+		Kind:    kind,
+		Limited: !p.b.Unlimited(),
+		Stats: Stats{
+			Allocated: p.allocated.Load(),
+			Consumed:  p.consumed.Load(),
+		},
+	}
+	if p.conf != nil {
+		c := *p.conf
+		s.Rate = &c
+	}
+	return s
+}
+
+//Finished implements the limio.Finisher interface, returning a channel that
+//is closed once the Pacer is closed.
+func (p *Pacer) Finished() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+//Close fails every waiting and future Acquire with ErrClosed and reports to
+//the Pacer's parent that it has shut down. Closing more than once returns
+//ErrClosed.
+func (p *Pacer) Close() error {
+	if !p.stop() {
+		return ErrClosed
+	}
+	p.finish()
+	return nil
+}
+
+//stop marks the Pacer closed, returning false if it already was.
+func (p *Pacer) stop() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.closed = true
+	p.cancel()
+	return true
+}
+
+//finish reports to the Pacer's parent that it has shut down.
+func (p *Pacer) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stopFeed()
+	notify(p.done, true)
+	p.done = nil
+}
+
+//Pace returns a channel that receives the items sent on in, each once a has
+//granted one token. The channel is closed once in is closed, ctx is done, or
+//a fails.
+func Pace[T any](ctx context.Context, in <-chan T, a Acquirer) <-chan T {
+	return PaceFunc(ctx, in, a, nil)
+}
+
+//PaceFunc is like Pace, but each item costs the number of tokens returned by
+//cost, such as its size in bytes.
+func PaceFunc[T any](ctx context.Context, in <-chan T, a Acquirer, cost func(T) int) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+
+		for {
+			var v T
+			select {
+			case item, ok := <-in:
+				if !ok {
+					return
+				}
+				v = item
+			case <-ctx.Done():
+				return
+			}
+
+			release, err := a.Acquire(ctx, itemCost(v, cost))
+			if err != nil {
+				return
+			}
+
+			select {
+			case out <- v:
+				release()
+			case <-ctx.Done():
+				release()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+//PaceSeq returns an iterator over the items of seq, yielding each once a has
+//granted one token. Iteration stops early if ctx is done or a fails.
+func PaceSeq[T any](ctx context.Context, seq iter.Seq[T], a Acquirer) iter.Seq[T] {
+	return PaceSeqFunc(ctx, seq, a, nil)
+}
+
+//PaceSeqFunc is like PaceSeq, but each item costs the number of tokens
+//returned by cost.
+func PaceSeqFunc[T any](ctx context.Context, seq iter.Seq[T], a Acquirer, cost func(T) int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range seq {
+			release, err := a.Acquire(ctx, itemCost(v, cost))
+			if err != nil {
+				return
+			}
+
+			more := yield(v)
+			release()
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+func itemCost[T any](v T, cost func(T) int) int {
+	if cost == nil {
+		return 1
+	}
+	return max(cost(v), 0)
+}
@@ -0,0 +1,125 @@
+package limio
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacer(t *testing.T) {
+	asrt := assert.New(t)
+
+	p := NewPacer()
+	asrt.Implements((*Limiter)(nil), p)
+	asrt.Implements((*Acquirer)(nil), p)
+
+	ch := make(chan int)
+	done := p.Limit(ch)
+
+	res := make(chan error)
+	go func() {
+		_, err := p.Acquire(context.Background(), 3)
+		res <- err
+	}()
+	for p.Demand() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	ch <- 2
+	ch <- 1
+	asrt.NoError(<-res)
+
+	//Tokens are not saved up beyond one grant while nothing waits
+	p.put(5)
+	p.put(5)
+	asrt.Equal(5, p.b.TryTake(100))
+
+	go func() {
+		_, err := p.Acquire(context.Background(), 1)
+		res <- err
+	}()
+	for p.Demand() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.NoError(p.Close())
+	asrt.Equal(ErrClosed, <-res)
+	asrt.True(<-done)
+
+	s := p.Describe()
+	asrt.Equal("pacer", s.Kind)
+	asrt.Equal(int64(3), s.Stats.Consumed)
+}
+
+func TestPace(t *testing.T) {
+	asrt := assert.New(t)
+
+	p := NewPacer()
+	defer p.Close()
+	p.SimpleLimitBurst(100, time.Second, 1)
+
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 6; i++ {
+			in <- i
+		}
+	}()
+
+	start := time.Now()
+	var got []int
+	for v := range Pace(context.Background(), in, p) {
+		got = append(got, v)
+	}
+	asrt.Equal([]int{0, 1, 2, 3, 4, 5}, got)
+	asrt.True(time.Since(start) >= 40*time.Millisecond, "6 items at 100/s took %v", time.Since(start))
+
+	//Costs come from the items, and the output closes with ctx
+	ch := make(chan int)
+	p.Limit(ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	in = make(chan int, 2)
+	in <- 2
+	in <- 3
+	out := PaceFunc(ctx, in, p, func(v int) int { return v })
+
+	ch <- 2
+	asrt.Equal(2, <-out)
+	ch <- 2
+	select {
+	case v := <-out:
+		t.Fatalf("%d was sent before its cost was paid", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	_, ok := <-out
+	asrt.False(ok)
+}
+
+func TestPaceSeq(t *testing.T) {
+	asrt := assert.New(t)
+
+	sem := NewSemaphore(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	seq := PaceSeqFunc(ctx, slices.Values([]string{"a", "bb", "c"}), sem, func(s string) int { return len(s) })
+
+	//Each item holds its slots while the loop body runs
+	var got []string
+	for v := range seq {
+		asrt.Equal(1, sem.InUse())
+		got = append(got, v)
+	}
+	asrt.Equal([]string{"a"}, got, "an item costing more than there are slots never passes")
+	asrt.Equal(0, sem.InUse())
+
+	p := NewPacer()
+	defer p.Close()
+	asrt.Equal([]int{1, 2, 3}, slices.Collect(PaceSeq(context.Background(), slices.Values([]int{1, 2, 3}), p)))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	p.SimpleLimit(1, time.Hour)
+	asrt.Empty(slices.Collect(PaceSeq(ctx, slices.Values([]int{1, 2, 3}), p)))
+}
@@ -0,0 +1,222 @@
+package limio
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//A PacketLimit limits the datagrams passing one way through a PacketConn, by
+//packets and by bytes at once. A Rate whose N is zero does not limit.
+type PacketLimit struct {
+	Packets Rate
+	Bytes   Rate
+
+	//Drop discards datagrams over the limit rather than waiting for them to
+	//fit. A datagram larger than the byte Burst is then always dropped.
+	Drop bool
+}
+
+//A PacketConn is a net.PacketConn whose datagrams are limited in each
+//direction by a PacketLimit. Datagrams cannot be split, so each waits until
+//there are tokens for the whole of it, or is dropped and counted.
+//
+//Reads are limited once a datagram has arrived, since only then is its size
+//known: a datagram that is dropped, or whose wait is cut short by the read
+//deadline or by Close, is lost. Deadlines apply to waits that begin after
+//they are set.
+//
+//A PacketConn is safe for concurrent use.
+type PacketConn struct {
+	net.PacketConn
+
+	read, write *packetLimiter
+
+	//ctx is canceled once the PacketConn is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	rdead time.Time
+	wdead time.Time
+}
+
+//NewPacketConn returns an unlimited PacketConn wrapping pc.
+func NewPacketConn(pc net.PacketConn) *PacketConn {
+	c := &PacketConn{
+		PacketConn: pc,
+		read:       newPacketLimiter(),
+		write:      newPacketLimiter(),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+//SetReadLimit limits the datagrams read.
+func (c *PacketConn) SetReadLimit(l PacketLimit) {
+	c.read.set(l)
+}
+
+//SetWriteLimit limits the datagrams written.
+func (c *PacketConn) SetWriteLimit(l PacketLimit) {
+	c.write.set(l)
+}
+
+//Drops returns the number of datagrams dropped for being over the limit in
+//each direction.
+func (c *PacketConn) Drops() (read, write int64) {
+	return c.read.drops.Load(), c.write.drops.Load()
+}
+
+//ReadFrom implements net.PacketConn, reading datagrams until one is within
+//the read limit.
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+
+		ok, err := c.read.admit(c.ctx, c.deadline(&c.rdead), n)
+		if err != nil {
+			return 0, nil, err
+		}
+		if ok {
+			return n, addr, nil
+		}
+	}
+}
+
+//WriteTo implements net.PacketConn. A datagram dropped for being over the
+//limit is reported as written, as it would be if the network had lost it.
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	ok, err := c.write.admit(c.ctx, c.deadline(&c.wdead), len(p))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+//SetDeadline implements net.PacketConn.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdead, c.wdead = t, t
+	c.mu.Unlock()
+	return c.PacketConn.SetDeadline(t)
+}
+
+//SetReadDeadline implements net.PacketConn.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdead = t
+	c.mu.Unlock()
+	return c.PacketConn.SetReadDeadline(t)
+}
+
+//SetWriteDeadline implements net.PacketConn.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wdead = t
+	c.mu.Unlock()
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+//Close implements net.PacketConn, failing any waits for tokens with
+//net.ErrClosed.
+func (c *PacketConn) Close() error {
+	c.cancel()
+	return c.PacketConn.Close()
+}
+
+func (c *PacketConn) deadline(d *time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *d
+}
+
+//packetLimiter limits one direction of a PacketConn.
+type packetLimiter struct {
+	packets, bytes *Bucket
+	drop           atomic.Bool
+	drops          atomic.Int64
+}
+
+func newPacketLimiter() *packetLimiter {
+	return &packetLimiter{packets: NewBucket(), bytes: NewBucket()}
+}
+
+func (pl *packetLimiter) set(l PacketLimit) {
+	setBucketRate(pl.packets, l.Packets)
+	setBucketRate(pl.bytes, l.Bytes)
+	pl.drop.Store(l.Drop)
+}
+
+func setBucketRate(b *Bucket, r Rate) {
+	if r.N <= 0 || r.Per <= 0 {
+		b.Unlimit()
+		return
+	}
+	b.SetRate(r.N, r.Per, r.Burst)
+}
+
+//admit takes the tokens for a datagram of n bytes, returning false if it
+//must be dropped. Waits end with net.ErrClosed once closed is canceled, or
+//os.ErrDeadlineExceeded once deadline, if set, passes.
+func (pl *packetLimiter) admit(closed context.Context, deadline time.Time, n int) (bool, error) {
+	if closed.Err() != nil {
+		return false, net.ErrClosed
+	}
+
+	if pl.drop.Load() {
+		if pl.tryTake(n) {
+			return true, nil
+		}
+		pl.drops.Add(1)
+		return false, nil
+	}
+
+	ctx, cancel := closed, context.CancelFunc(func() {})
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(closed, deadline)
+	}
+	defer cancel()
+
+	if _, err := pl.packets.Acquire(ctx, 1); err != nil {
+		return false, packetErr(closed, err)
+	}
+	if _, err := pl.bytes.Acquire(ctx, n); err != nil {
+		pl.packets.Put(1)
+		return false, packetErr(closed, err)
+	}
+	return true, nil
+}
+
+//tryTake takes the tokens for a datagram of n bytes if all of them are
+//available right now.
+func (pl *packetLimiter) tryTake(n int) bool {
+	if pl.packets.TryTake(1) < 1 {
+		return false
+	}
+	if got := pl.bytes.TryTake(n); got < n {
+		pl.bytes.Put(got)
+		pl.packets.Put(1)
+		return false
+	}
+	return true
+}
+
+func packetErr(closed context.Context, err error) error {
+	if closed.Err() != nil {
+		return net.ErrClosed
+	}
+	if err == context.DeadlineExceeded {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package limio
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func udpPair(t *testing.T) (net.PacketConn, net.PacketConn) {
+	a, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no loopback UDP:", err)
+	}
+	b, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		a.Close()
+		t.Skip("no loopback UDP:", err)
+	}
+	return a, b
+}
+
+func TestPacketConnWrite(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := udpPair(t)
+	defer b.Close()
+
+	c := NewPacketConn(a)
+	defer c.Close()
+
+	//100 packets per second and 1KB per second, whichever is stricter
+	c.SetWriteLimit(PacketLimit{
+		Packets: Rate{N: 100, Per: time.Second, Burst: 1},
+		Bytes:   Rate{N: KB, Per: time.Second, Burst: 100},
+	})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		n, err := c.WriteTo(make([]byte, 10), b.LocalAddr())
+		asrt.NoError(err)
+		asrt.Equal(10, n)
+	}
+	//Packets: 4 more after the first, at 10ms each
+	asrt.InDelta(40*time.Millisecond, time.Since(start), float64(25*time.Millisecond))
+
+	//Large datagrams are held back by the bytes instead
+	_, err := c.WriteTo(make([]byte, 100), b.LocalAddr())
+	asrt.NoError(err)
+	start = time.Now()
+	_, err = c.WriteTo(make([]byte, 100), b.LocalAddr())
+	asrt.NoError(err)
+	asrt.InDelta(100*time.Millisecond, time.Since(start), float64(25*time.Millisecond))
+
+	read, write := c.Drops()
+	asrt.Zero(read)
+	asrt.Zero(write)
+}
+
+func TestPacketConnDrop(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := udpPair(t)
+	defer b.Close()
+
+	c := NewPacketConn(a)
+	defer c.Close()
+
+	c.SetWriteLimit(PacketLimit{
+		Packets: Rate{N: 1, Per: time.Hour, Burst: 3},
+		Bytes:   Rate{N: 1, Per: time.Hour, Burst: 25},
+		Drop:    true,
+	})
+
+	for i := 0; i < 4; i++ {
+		n, err := c.WriteTo(make([]byte, 10), b.LocalAddr())
+		asrt.NoError(err)
+		asrt.Equal(10, n)
+	}
+	//Two fit the bytes; the third fits the packets but not the bytes
+	_, write := c.Drops()
+	asrt.EqualValues(2, write)
+
+	b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	got := 0
+	p := make([]byte, 64)
+	for {
+		if _, _, err := b.ReadFrom(p); err != nil {
+			break
+		}
+		got++
+	}
+	asrt.Equal(2, got)
+}
+
+func TestPacketConnRead(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := udpPair(t)
+	defer a.Close()
+
+	c := NewPacketConn(b)
+	defer c.Close()
+
+	c.SetReadLimit(PacketLimit{Packets: Rate{N: 1, Per: time.Hour, Burst: 1}, Drop: true})
+
+	for i := 0; i < 3; i++ {
+		_, err := a.WriteTo([]byte{byte(i)}, c.LocalAddr())
+		asrt.NoError(err)
+	}
+
+	p := make([]byte, 8)
+	n, addr, err := c.ReadFrom(p)
+	asrt.NoError(err)
+	asrt.Equal([]byte{0}, p[:n])
+	asrt.Equal(a.LocalAddr().String(), addr.String())
+
+	//The rest are dropped while waiting for one within the limit
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err = c.ReadFrom(p)
+	asrt.True(errors.Is(err, os.ErrDeadlineExceeded))
+
+	read, _ := c.Drops()
+	asrt.EqualValues(2, read)
+}
+
+func TestPacketConnDeadline(t *testing.T) {
+	asrt := assert.New(t)
+
+	a, b := udpPair(t)
+	defer b.Close()
+
+	c := NewPacketConn(a)
+
+	c.SetWriteLimit(PacketLimit{Packets: Rate{N: 1, Per: time.Hour, Burst: 1}})
+	_, err := c.WriteTo([]byte("x"), b.LocalAddr())
+	asrt.NoError(err)
+
+	c.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err = c.WriteTo([]byte("x"), b.LocalAddr())
+	asrt.Equal(os.ErrDeadlineExceeded, err)
+
+	c.SetWriteDeadline(time.Time{})
+	errs := make(chan error)
+	go func() {
+		_, err := c.WriteTo([]byte("x"), b.LocalAddr())
+		errs <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	asrt.NoError(c.Close())
+	asrt.Equal(net.ErrClosed, <-errs)
+}
@@ -0,0 +1,156 @@
+package limio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+//A Progress is a report on a transfer, such as the bytes read through a
+//Reader with OnProgress set.
+type Progress struct {
+	//Bytes is how many bytes have been transferred, of Total if it is known
+	//(and zero otherwise).
+	Bytes int64
+	Total int64
+
+	//Rate is the bytes per second since the last report, and Average since
+	//reporting began.
+	Rate    float64
+	Average float64
+
+	//Elapsed is the time since reporting began, and ETA the time left at
+	//the Average rate, or -1 if it cannot be told.
+	Elapsed time.Duration
+	ETA     time.Duration
+
+	//Final is set for the report at the end of the transfer.
+	Final bool
+}
+
+//progressBar is the width of the bar drawn by Progress.String.
+const progressBar = 20
+
+//String renders p as a single line in the style of pv, for example
+//
+//	1.9MB 0:00:02 [ 1.0MB/s] [976.6KB/s] [=======>            ]  40% ETA 0:00:03
+//
+//The bar, percentage and ETA are only shown if the Total is known.
+func (p Progress) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s %s [%7s/s] [%7s/s]", fmtBytes(float64(p.Bytes)), fmtClock(p.Elapsed), fmtBytes(p.Rate), fmtBytes(p.Average))
+	if p.Total <= 0 {
+		return sb.String()
+	}
+
+	frac := math.Min(float64(p.Bytes)/float64(p.Total), 1)
+	fill := int(frac * progressBar)
+	bar := strings.Repeat("=", fill) + strings.Repeat(" ", progressBar-fill)
+	if fill > 0 && fill < progressBar {
+		bar = bar[:fill-1] + ">" + bar[fill:]
+	}
+	fmt.Fprintf(sb, " [%s] %3d%%", bar, int(frac*100))
+
+	if !p.Final {
+		eta := "?"
+		if p.ETA >= 0 {
+			eta = fmtClock(p.ETA)
+		}
+		fmt.Fprintf(sb, " ETA %s", eta)
+	}
+	return sb.String()
+}
+
+//fmtBytes formats n using the sizes defined by this package.
+func fmtBytes(n float64) string {
+	for _, suf := range sizeSuffixes {
+		if suf.size > B && n >= float64(suf.size) {
+			return fmt.Sprintf("%.1f%s", n/float64(suf.size), suf.suffix)
+		}
+	}
+	return fmt.Sprintf("%.0fB", n)
+}
+
+//fmtClock formats d as hours, minutes and seconds.
+func fmtClock(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+//meter turns running totals into Progress reports for a progress hook.
+type meter struct {
+	mu *sync.Mutex
+	//fnM is held while calling fn, so that reports are made in order without
+	//holding mu
+	fnM *sync.Mutex
+
+	every time.Duration
+	total int64
+	fn    func(Progress)
+
+	start    time.Time
+	last     time.Time
+	base     int64
+	lastDone int64
+	final    bool
+
+	now func() time.Time
+}
+
+//newMeter returns a meter for reports every interval to fn, measuring from
+//done bytes having already been transferred.
+func newMeter(every time.Duration, total, done int64, fn func(Progress)) *meter {
+	m := &meter{
+		mu:       &sync.Mutex{},
+		fnM:      &sync.Mutex{},
+		every:    every,
+		total:    total,
+		fn:       fn,
+		base:     done,
+		lastDone: done,
+		now:      time.Now,
+	}
+	m.start = m.now()
+	m.last = m.start
+	return m
+}
+
+//report calls the hook with done bytes having now been transferred, and
+//final set if the transfer is over. Nothing more is reported once the
+//transfer is over.
+func (m *meter) report(done int64, final bool) {
+	m.mu.Lock()
+	if m.final {
+		m.mu.Unlock()
+		return
+	}
+
+	now := m.now()
+	p := Progress{
+		Bytes:   done,
+		Total:   m.total,
+		Elapsed: now.Sub(m.start),
+		ETA:     -1,
+		Final:   final,
+	}
+	if dt := now.Sub(m.last); dt > 0 {
+		p.Rate = float64(done-m.lastDone) / dt.Seconds()
+	}
+	if p.Elapsed > 0 {
+		p.Average = float64(done-m.base) / p.Elapsed.Seconds()
+	}
+	switch {
+	case final || m.total > 0 && done >= m.total:
+		p.ETA = 0
+	case m.total > 0 && p.Average > 0:
+		p.ETA = time.Duration(float64(m.total-done) / p.Average * float64(time.Second))
+	}
+	m.last, m.lastDone, m.final = now, done, final
+
+	m.fnM.Lock()
+	m.mu.Unlock()
+	m.fn(p)
+	m.fnM.Unlock()
+}
@@ -0,0 +1,126 @@
+package limio
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressString(t *testing.T) {
+	asrt := assert.New(t)
+
+	p := Progress{
+		Bytes:   int64(2 * MB),
+		Total:   int64(5 * MB),
+		Rate:    float64(MB),
+		Average: float64(1000 * KB),
+		Elapsed: 2 * time.Second,
+		ETA:     3 * time.Second,
+	}
+	asrt.Equal("2.0MB 0:00:02 [  1.0MB/s] [1000.0KB/s] [=======>            ]  40% ETA 0:00:03", p.String())
+
+	p.Bytes, p.ETA, p.Final = p.Total, 0, true
+	asrt.Equal("5.0MB 0:00:02 [  1.0MB/s] [1000.0KB/s] [====================] 100%", p.String())
+
+	p = Progress{Bytes: 512, Elapsed: 61 * time.Minute, ETA: -1}
+	asrt.Equal("512B 1:01:00 [     0B/s] [     0B/s]", p.String())
+
+	p.Total = 1024
+	asrt.Equal("512B 1:01:00 [     0B/s] [     0B/s] [=========>          ]  50% ETA ?", p.String())
+}
+
+func TestMeter(t *testing.T) {
+	asrt := assert.New(t)
+
+	var got []Progress
+	m := newMeter(time.Second, 1000, 0, func(p Progress) { got = append(got, p) })
+	start := m.start
+	now := start
+	m.now = func() time.Time { return now }
+
+	now = start.Add(time.Second)
+	m.report(200, false)
+	now = start.Add(3 * time.Second)
+	m.report(300, false)
+	if asrt.Len(got, 2) {
+		asrt.Equal(Progress{Bytes: 200, Total: 1000, Rate: 200, Average: 200, Elapsed: time.Second, ETA: 4 * time.Second}, got[0])
+		asrt.Equal(Progress{Bytes: 300, Total: 1000, Rate: 50, Average: 100, Elapsed: 3 * time.Second, ETA: 7 * time.Second}, got[1])
+	}
+
+	//The end is reported once, and nothing after it
+	now = start.Add(3100 * time.Millisecond)
+	m.report(1000, true)
+	m.report(1000, true)
+	m.report(1000, false)
+	if asrt.Len(got, 3) {
+		asrt.True(got[2].Final)
+		asrt.Zero(got[2].ETA)
+	}
+}
+
+func TestReaderProgress(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+	r.SimpleLimit(10*KB, time.Second)
+
+	var got []Progress
+	r.OnProgress(20*time.Millisecond, int64(len(testText)), func(p Progress) { got = append(got, p) })
+
+	_, err := io.Copy(io.Discard, r)
+	asrt.NoError(err)
+
+	//About 2.5KB at 10KB/s, reported every 20ms and at the end
+	if !asrt.True(len(got) > 2, "got %d reports", len(got)) {
+		return
+	}
+	last := got[len(got)-1]
+	asrt.True(last.Final)
+	asrt.EqualValues(len(testText), last.Bytes)
+	asrt.InDelta(float64(10*KB), last.Average, float64(2*KB))
+	for i, p := range got[:len(got)-1] {
+		asrt.False(p.Final)
+		asrt.True(p.ETA >= 0)
+		asrt.True(p.Bytes <= got[i+1].Bytes)
+	}
+}
+
+func TestReaderProgressBlocked(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+	r.Limit(make(chan int))
+
+	reports := make(chan Progress, 10)
+	r.OnProgress(10*time.Millisecond, int64(len(testText)), func(p Progress) {
+		select {
+		case reports <- p:
+		default:
+		}
+	})
+	go r.Read(make([]byte, 10))
+
+	//A Read waiting for its limit is still reported on
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-reports:
+			asrt.Zero(p.Bytes)
+			asrt.False(p.Final)
+		case <-time.After(time.Second):
+			t.Fatal("no report while blocked")
+		}
+	}
+
+	r.OnProgress(0, 0, nil)
+	time.Sleep(20 * time.Millisecond)
+	for len(reports) > 0 {
+		<-reports
+	}
+	time.Sleep(30 * time.Millisecond)
+	asrt.Zero(len(reports), "reporting stopped")
+}
@@ -0,0 +1,97 @@
+package limio
+
+import (
+	"math"
+	"time"
+)
+
+//A Ramp describes a gradual change of rate, used to avoid throughput cliffs
+//when a limit changes. A Ramp moves from the old rate to the new one Over the
+//given duration, either linearly or, if Exponential is set, by a constant
+//factor per unit time. The zero Ramp changes rate immediately.
+type Ramp struct {
+	Over        time.Duration
+	Exponential bool
+}
+
+//interpolate returns the value between from and to that the Ramp has reached
+//after elapsed. Exponential ramps fall back to linear when either end is not
+//positive.
+func (r Ramp) interpolate(from, to float64, elapsed time.Duration) float64 {
+	if r.Over <= 0 || elapsed >= r.Over {
+		return to
+	}
+	if elapsed < 0 {
+		return from
+	}
+
+	f := float64(elapsed) / float64(r.Over)
+	if r.Exponential && from > 0 && to > 0 {
+		return from * math.Pow(to/from, f)
+	}
+	return from + (to-from)*f
+}
+
+//ramping tracks a ramp in progress in a run loop. Rates are in tokens per
+//nanosecond.
+type ramping struct {
+	Ramp
+	from, to float64
+	start    time.Time
+	carry    float64
+}
+
+//rate returns the rate the ramp has reached at now.
+func (r *ramping) rate(now time.Time) float64 {
+	return r.interpolate(r.from, r.to, now.Sub(r.start))
+}
+
+//next returns the tokens for a tick of the given period ending at now,
+//carrying fractions over to the next tick.
+func (r *ramping) next(now time.Time, period time.Duration) int {
+	r.carry += r.rate(now) * float64(period)
+	n := int(r.carry)
+	r.carry -= float64(n)
+	return n
+}
+
+//done reports whether the ramp has reached its target rate.
+func (r *ramping) done(now time.Time) bool {
+	return now.Sub(r.start) >= r.Over
+}
+
+//currentRate returns the rate, in tokens per nanosecond, that a run loop is
+//delivering under l (and rm, if a ramp is in progress), or false if l is not
+//a rate.
+func currentRate(l *limit, rm *ramping, now time.Time) (float64, bool) {
+	if rm != nil {
+		return rm.rate(now), true
+	}
+	if l == nil || l.rate.n <= 0 || l.rate.t <= 0 {
+		return 0, false
+	}
+	return float64(l.rate.n) / float64(l.rate.t), true
+}
+
+//startRamp returns the ramp from the rate delivered under prev (and prm) to
+//the smoothed rate of next, or nil if next should take effect immediately.
+//next.rate must already have been distributed into ticks.
+func startRamp(prev *limit, prm *ramping, next *limit, now time.Time) *ramping {
+	if next.ramp.Over <= 0 || next.rate.n <= 0 || next.rate.t <= 0 {
+		return nil
+	}
+	from, ok := currentRate(prev, prm, now)
+	if !ok {
+		return nil
+	}
+	return &ramping{
+		Ramp:  next.ramp,
+		from:  from,
+		to:    float64(next.rate.n) / float64(next.rate.t),
+		start: now,
+	}
+}
+
+//slowStartFloor is the fraction of its fair share a newly managed Limiter
+//starts with under slow start.
+const slowStartFloor = 1.0 / 32
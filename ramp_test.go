@@ -0,0 +1,108 @@
+package limio
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRampInterpolate(t *testing.T) {
+	asrt := assert.New(t)
+
+	lin := Ramp{Over: time.Second}
+	asrt.Equal(10.0, lin.interpolate(10, 20, 0))
+	asrt.Equal(15.0, lin.interpolate(10, 20, 500*time.Millisecond))
+	asrt.Equal(20.0, lin.interpolate(10, 20, 2*time.Second))
+
+	exp := Ramp{Over: time.Second, Exponential: true}
+	asrt.InDelta(20.0, exp.interpolate(10, 40, 500*time.Millisecond), 1e-9)
+	asrt.Equal(40.0, exp.interpolate(10, 40, time.Second))
+
+	//Exponential ramps from zero fall back to linear
+	asrt.Equal(20.0, exp.interpolate(0, 40, 500*time.Millisecond))
+
+	asrt.Equal(20.0, Ramp{}.interpolate(10, 20, 0))
+}
+
+func TestRamping(t *testing.T) {
+	asrt := assert.New(t)
+
+	start := time.Now()
+	rm := &ramping{
+		Ramp:  Ramp{Over: time.Second},
+		from:  0,
+		to:    1.0 / float64(time.Millisecond),
+		start: start,
+	}
+
+	//Halfway through, half a token per millisecond
+	total := 0
+	for i := 0; i < 10; i++ {
+		total += rm.next(start.Add(500*time.Millisecond), time.Millisecond)
+	}
+	asrt.Equal(5, total)
+	asrt.False(rm.done(start.Add(500 * time.Millisecond)))
+	asrt.True(rm.done(start.Add(time.Second)))
+
+	asrt.Nil(startRamp(&limit{}, nil, &limit{ramp: rm.Ramp, rate: rate{n: 1, t: time.Millisecond}}, start),
+		"an unlimited limiter has no rate to ramp from")
+}
+
+func TestReaderRamp(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(strings.Repeat(testText, 100)))
+	defer r.Close()
+
+	r.SimpleLimit(10*KB, time.Second)
+	r.SimpleLimitRamp(10*MB, time.Second, Ramp{Over: 200 * time.Millisecond})
+
+	//Ramping up, less than the new rate should pass in the first 50ms
+	start := time.Now()
+	n, _ := io.CopyN(io.Discard, r, int64(100*KB))
+	asrt.EqualValues(100*KB, n)
+	asrt.True(time.Since(start) > 20*time.Millisecond, "ramp should delay the new rate")
+}
+
+func TestSlowStart(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+	lmr.SetSlowStart(Ramp{Over: 100 * time.Millisecond, Exponential: true})
+
+	ch := make(chan int, 1)
+	lmr.Limit(ch)
+
+	text := strings.Repeat(testText, 100)
+	r1 := lmr.NewReader(strings.NewReader(text))
+	r2 := lmr.NewReader(strings.NewReader(text))
+
+	//Both just joined, so each only gets a small part of its share, even
+	//though nobody else wants the rest
+	ch <- 640
+	p := make([]byte, 640)
+	n1, _ := r1.Read(p)
+	n2, _ := r2.Read(p)
+	asrt.True(n1 < 100 && n2 < 100, "starters got %d and %d of 640", n1, n2)
+
+	//The rest was carried over to when they have grown to their full share
+	time.Sleep(150 * time.Millisecond)
+	ch <- 64
+	n1, _ = r1.Read(p)
+	n2, _ = r2.Read(p)
+	asrt.InDelta(64+640-20, n1+n2, 40)
+
+	//A newcomer starts with a small part of its own share
+	r3 := lmr.NewReader(bytes.NewReader([]byte(text)))
+	for !Describe(r3).Limited {
+		time.Sleep(time.Millisecond)
+	}
+	ch <- 3000
+	n, _ := r3.Read(make([]byte, 3000))
+	asrt.True(n < 1000, "newcomer got %d of 3000", n)
+}
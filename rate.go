@@ -0,0 +1,80 @@
+package limio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Rate describes a configured limit of N operations per duration Per. Burst, if
+//set, is the largest quantity granted at once.
+type Rate struct {
+	N     int           `json:"n"`
+	Per   time.Duration `json:"per"`
+	Burst int           `json:"burst,omitempty"`
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.N, r.Per)
+}
+
+//ErrInvalidRate is returned by ParseRate and ParseSize for malformed input.
+var ErrInvalidRate = errors.New("invalid rate")
+
+var sizeSuffixes = []struct {
+	suffix string
+	size   int
+}{
+	{"EB", EB}, {"PB", PB}, {"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB}, {"B", B},
+}
+
+//ParseSize parses a quantity with an optional byte-size suffix, such as "512",
+//"64KB" or "10MB". Suffixes use the binary sizes defined by this package.
+func ParseSize(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	mult := 1
+	for _, suf := range sizeSuffixes {
+		if strings.HasSuffix(strings.ToUpper(s), suf.suffix) {
+			s, mult = strings.TrimSpace(s[:len(s)-len(suf.suffix)]), suf.size
+			break
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: bad size %q", ErrInvalidRate, s)
+	}
+	if n > math.MaxInt/mult {
+		return 0, fmt.Errorf("%w: size %q is too large", ErrInvalidRate, s)
+	}
+	return n * mult, nil
+}
+
+//ParseRate parses a rate of the form "<size>/<duration>", such as "10MB/s",
+//"1KB/100ms" or "200/1m". A duration without a number is taken to mean one
+//of that unit.
+func ParseRate(s string) (Rate, error) {
+	size, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: %q has no \"/\"", ErrInvalidRate, s)
+	}
+
+	n, err := ParseSize(size)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	per = strings.TrimSpace(per)
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+
+	t, err := time.ParseDuration(per)
+	if err != nil || t <= 0 || n == 0 {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+	return Rate{N: n, Per: t}, nil
+}
@@ -0,0 +1,62 @@
+package limio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	asrt := assert.New(t)
+
+	for in, out := range map[string]Rate{
+		"10MB/s":    {N: 10 * MB, Per: time.Second},
+		"1KB/100ms": {N: KB, Per: 100 * time.Millisecond},
+		"200/1m":    {N: 200, Per: time.Minute},
+		" 64 kb/ h": {N: 64 * KB, Per: time.Hour},
+	} {
+		r, err := ParseRate(in)
+		asrt.NoError(err, in)
+		asrt.Equal(out, r, in)
+	}
+
+	for _, in := range []string{"", "10MB", "MB/s", "10MB/x", "0/s", "-1/s", "1/0s"} {
+		_, err := ParseRate(in)
+		asrt.True(errors.Is(err, ErrInvalidRate), in)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	asrt := assert.New(t)
+
+	n, err := ParseSize("64kb")
+	asrt.NoError(err)
+	asrt.Equal(64*KB, n)
+
+	for _, in := range []string{"lots", "-1KB", "9999999999999GB", "99999999999999999999"} {
+		_, err := ParseSize(in)
+		asrt.ErrorIs(err, ErrInvalidRate, in)
+	}
+}
+
+func TestSimpleLimitBurst(t *testing.T) {
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+
+	//1KB/s in grants of 100 bytes
+	r.SimpleLimitBurst(KB, time.Second, 100)
+
+	p := make([]byte, len(testText))
+	n, err := r.Read(p)
+
+	if err != nil {
+		t.Errorf("error reading: %v", err)
+	}
+
+	if n != 100 {
+		t.Errorf("Wrong number of bytes in burst: %d, should be %d", n, 100)
+	}
+}
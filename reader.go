@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -12,27 +13,86 @@ import (
 //Reader implements an io-limited reader that conforms to the io.Reader and
 //limio.Limiter interface. Reader can have its limits updated concurrently with
 //any Read() calls.
+//
+//Once a Reader is closed, Read and SetTimeout return ErrClosed, further limits
+//are ignored (their channels report finality straight away), and a Read that
+//was blocked waiting for tokens returns ErrClosed immediately.
 type Reader struct {
-	r   io.Reader
-	eof bool
+	r      io.Reader
+	closer io.Closer
+	eof    bool
 
 	limitedM *sync.RWMutex
 	limited  bool
+	bucket   *Bucket
+	refundTo func(int)
+	changed  chan struct{}
 
 	timeoutM *sync.Mutex
 	timeout  time.Duration
 
+	infoM *sync.Mutex
+	name  string
+	conf  *Rate
+	head  *headStart
+
+	allocated atomic.Int64
+	consumed  atomic.Int64
+	demand    atomic.Int64
+	headRead  atomic.Int64
+	meter     atomic.Pointer[meter]
+	metered   chan struct{} //signals run that the meter has been replaced
+
+	//balance holds tokens granted under the limit identified by balanceFor
+	//that a short read left unspent. Only Read may access them.
+	balance    int
+	balanceFor chan struct{}
+
 	rate     chan int
 	used     chan int
 	newLimit chan *limit
-	cls      chan bool
+
+	clsOnce *sync.Once
+	closed  chan struct{}
+	stopped chan struct{}
+}
+
+//headStart is the part of a Reader's input that bypasses its limit.
+type headStart struct {
+	bytes   int64
+	d       time.Duration
+	started time.Time
 }
 
 type limit struct {
-	lim   <-chan int
-	rate  rate
-	ready chan<- struct{}
-	done  chan<- bool
+	lim    <-chan int
+	refund func(int) //takes back tokens from lim that went unspent, if set
+	bucket *Bucket
+	rate   rate
+	window time.Duration
+	ramp   Ramp
+	ready  chan<- struct{}
+	done   chan<- bool
+}
+
+//newRateLimit returns a limit for the given Rate, choosing a smoothing window
+//that yields grants of Rate.Burst, or DefaultWindow if there is no burst.
+func newRateLimit(r Rate, done chan<- bool, ready chan<- struct{}) *limit {
+	l := &limit{
+		rate:   rate{r.N, r.Per},
+		window: DefaultWindow,
+		done:   done,
+		ready:  ready,
+	}
+	if r.Burst > 0 && r.N > 0 {
+		l.window = r.Per * time.Duration(r.Burst) / time.Duration(r.N)
+	}
+	return l
+}
+
+//unlimited reports whether l removes any limit, as sent by Unlimit.
+func (l *limit) unlimited() bool {
+	return l.lim == nil && l.bucket == nil && l.rate == rate{}
 }
 
 type rate struct {
@@ -45,30 +105,90 @@ func NewReader(r io.Reader) *Reader {
 	lr := Reader{
 		r:        r,
 		limitedM: &sync.RWMutex{},
+		changed:  make(chan struct{}),
 		timeoutM: &sync.Mutex{},
+		infoM:    &sync.Mutex{},
 		newLimit: make(chan *limit),
+		metered:  make(chan struct{}, 1),
 		rate:     make(chan int, 10),
 		used:     make(chan int),
-		cls:      make(chan bool),
+		clsOnce:  &sync.Once{},
+		closed:   make(chan struct{}),
+		stopped:  make(chan struct{}),
 	}
 	go lr.run()
 	return &lr
 }
 
+//NewReadCloser is like NewReader, but closing the returned Reader also closes
+//rc. This is also the only way to interrupt a Read that is blocked in rc
+//itself, rather than waiting for tokens.
+func NewReadCloser(rc io.ReadCloser) *Reader {
+	lr := NewReader(rc)
+	lr.closer = rc
+	return lr
+}
+
+//ErrClosed is returned by operations on a Limiter or Manager that has been
+//closed.
+var ErrClosed = errors.New("limiter is closed")
+
+//sendLimit hands l to run(), returning false if the Reader is closed.
+func (r *Reader) sendLimit(l *limit) bool {
+	select {
+	case r.newLimit <- l:
+		return true
+	case <-r.closed:
+		return false
+	}
+}
+
 //Unlimit removes any restrictions on the underlying io.Reader.
 func (r *Reader) Unlimit() {
-	r.newLimit <- nil
+	r.setConf(nil)
+	ready := make(chan struct{})
+	if r.sendLimit(&limit{ready: ready}) {
+		<-ready
+	}
+}
+
+func (r *Reader) setConf(c *Rate) {
+	r.infoM.Lock()
+	r.conf = c
+	r.infoM.Unlock()
 }
 
 //SimpleLimit takes an integer and a time.Duration and limits the underlying
 //reader non-burstily (given rate is averaged over a small time).
 func (r *Reader) SimpleLimit(n int, t time.Duration) <-chan bool {
+	return r.simpleLimit(Rate{N: n, Per: t})
+}
+
+//SimpleLimitBurst is like SimpleLimit, but smooths the rate into grants of at
+//most burst bytes rather than grants spread over DefaultWindow.
+func (r *Reader) SimpleLimitBurst(n int, t time.Duration, burst int) <-chan bool {
+	return r.simpleLimit(Rate{N: n, Per: t, Burst: burst})
+}
+
+//SimpleLimitRamp is like SimpleLimit, but moves gradually from the current
+//rate to the new one according to ramp. If the Reader was not limited by a
+//rate, the new rate applies immediately.
+func (r *Reader) SimpleLimitRamp(n int, t time.Duration, ramp Ramp) <-chan bool {
+	return r.simpleLimitRamp(Rate{N: n, Per: t}, ramp)
+}
+
+func (r *Reader) simpleLimit(rt Rate) <-chan bool {
+	return r.simpleLimitRamp(rt, Ramp{})
+}
+
+func (r *Reader) simpleLimitRamp(rt Rate, ramp Ramp) <-chan bool {
+	r.setConf(&rt)
 	done := make(chan bool, 1)
 	ready := make(chan struct{})
-	r.newLimit <- &limit{
-		rate:  rate{n, t},
-		done:  done,
-		ready: ready,
+	l := newRateLimit(rt, done, ready)
+	l.ramp = ramp
+	if !r.sendLimit(l) {
+		return finished()
 	}
 	<-ready
 	return done
@@ -77,12 +197,39 @@ func (r *Reader) SimpleLimit(n int, t time.Duration) <-chan bool {
 //Limit can be used to precisely control the limit at which bytes can be Read,
 //whether burstily or not.
 func (r *Reader) Limit(lch chan int) <-chan bool {
+	r.setConf(nil)
+	done := make(chan bool, 1)
+	ready := make(chan struct{})
+	if !r.sendLimit(&limit{lim: lch, done: done, ready: ready}) {
+		return finished()
+	}
+	<-ready
+	return done
+}
+
+//LimitRefund implements the limio.RefundLimiter interface. Tokens received on
+//lch that a short read leaves unspent are handed to refund rather than being
+//carried over by the Reader.
+func (r *Reader) LimitRefund(lch chan int, refund func(int)) <-chan bool {
+	r.setConf(nil)
+	done := make(chan bool, 1)
+	ready := make(chan struct{})
+	if !r.sendLimit(&limit{lim: lch, refund: refund, done: done, ready: ready}) {
+		return finished()
+	}
+	<-ready
+	return done
+}
+
+//LimitBucket implements the limio.BucketLimiter interface. Reads draw their
+//tokens directly from b, so the Reader may share b with any number of other
+//Limiters without a Manager pushing tokens to each of them.
+func (r *Reader) LimitBucket(b *Bucket) <-chan bool {
+	r.setConf(nil)
 	done := make(chan bool, 1)
 	ready := make(chan struct{})
-	r.newLimit <- &limit{
-		lim:   lch,
-		done:  done,
-		ready: ready,
+	if !r.sendLimit(&limit{bucket: b, done: done, ready: ready}) {
+		return finished()
 	}
 	<-ready
 	return done
@@ -91,9 +238,29 @@ func (r *Reader) Limit(lch chan int) <-chan bool {
 //Close allows the goroutines that were managing limits and reads to shut down
 //and free up memory. It should be called by any clients of the limio.Reader,
 //much as http.Response.Body should be closed to free up system resources.
+//
+//Any Read waiting for tokens returns ErrClosed, and the owner of the current
+//limit is told the Reader has shut down. If the Reader was created with
+//NewReadCloser, the underlying io.ReadCloser is closed too and its error is
+//returned. Closing a Reader more than once returns ErrClosed.
 func (r *Reader) Close() error {
-	r.cls <- true
-	return nil
+	err := ErrClosed
+	r.clsOnce.Do(func() {
+		close(r.closed)
+		<-r.stopped
+
+		err = nil
+		if r.closer != nil {
+			err = r.closer.Close()
+		}
+	})
+	return err
+}
+
+//Finished implements the limio.Finisher interface, returning a channel that
+//is closed once the Reader is closed.
+func (r *Reader) Finished() <-chan struct{} {
+	return r.closed
 }
 
 //ErrTimeoutExceeded will be returned upon a timeout lapsing without a read occuring
@@ -102,58 +269,90 @@ var ErrTimeoutExceeded error = errors.New("Timeout Exceeded")
 //Read implements io.Reader in a blocking manner according to the limits of the
 //limio.Reader.
 func (r *Reader) Read(p []byte) (written int, err error) {
+	select {
+	case <-r.closed:
+		return 0, ErrClosed
+	default:
+	}
+
 	if r.eof {
 		err = io.EOF
 		return
 	}
 
+	defer r.demand.Store(0)
+
 	var n int
 	var lim int
 	for written < len(p) && err == nil {
+		select {
+		case <-r.closed:
+			if written == 0 {
+				err = ErrClosed
+			}
+			return
+		default:
+		}
+
+		r.demand.Store(int64(max(len(p[written:])-r.balance, 0)))
 
 		r.limitedM.RLock()
 		isLimited := r.limited
+		bucket := r.bucket
+		refundTo := r.refundTo
+		changed := r.changed
 		r.limitedM.RUnlock()
 
-		if isLimited {
+		head := r.headRoom(len(p[written:]))
+		if head > 0 {
+			lim, isLimited, bucket = head, false, nil
+		} else if bucket != nil {
+			lim, err = r.takeBucket(bucket, changed, len(p[written:]), written > 0)
+			if err == ErrBucketCanceled {
+				//The limit changed while we were waiting
+				err = nil
+				continue
+			}
+			if err != nil || lim == 0 {
+				return
+			}
+			r.allocated.Add(int64(lim))
+		} else if isLimited && r.balance > 0 && r.balanceFor == changed {
+			lim, r.balance = r.balance, 0
+		} else if isLimited {
+			r.balance = 0
 
 			r.timeoutM.Lock()
 			timeLimit := r.timeout
 			r.timeoutM.Unlock()
 
-			//TODO consolidate two cases if possible. Dynamic select via reflection?
-			if timeLimit > 0 {
-				select {
-				case <-time.After(timeLimit):
-					err = ErrTimeoutExceeded
-					return
-				case lim = <-r.rate:
-				default:
-					if written > 0 {
-						return
-					}
-					lim = <-r.rate
-				}
-			} else {
-				select {
-				case lim = <-r.rate:
-				default:
-					if written > 0 {
-						return
-					}
-					lim = <-r.rate
-				}
+			lim, err = r.receive(written > 0, timeLimit)
+			if err != nil || lim == 0 && written > 0 {
+				return
 			}
+			r.allocated.Add(int64(lim))
 		} else {
 			lim = len(p[written:])
 		}
 
+		grant := lim
 		if lim > len(p[written:]) {
 			lim = len(p[written:])
 		}
 
 		n, err = r.r.Read(p[written:][:lim])
 		written += n
+		r.consumed.Add(int64(n))
+		if head > 0 {
+			r.headRead.Add(int64(n))
+		}
+		if m := r.meter.Load(); m != nil && err == io.EOF {
+			m.report(r.consumed.Load(), true)
+		}
+
+		if isLimited || bucket != nil {
+			r.refund(bucket, refundTo, changed, grant-n)
+		}
 
 		if err != nil {
 			if err == io.EOF {
@@ -165,6 +364,216 @@ func (r *Reader) Read(p []byte) (written int, err error) {
 	return
 }
 
+//SetHeadStart lets the first n bytes read, or those read within d of the
+//first Read, bypass the Reader's limit, whichever ends first, so that the
+//start of a download is not held back. Either may be zero to use the other
+//alone, and both zero removes the head start. The bytes read with the head
+//start are counted in the HeadStart of the Reader's Stats. Calling
+//SetHeadStart again replaces the head start with one beginning at the next
+//Read.
+func (r *Reader) SetHeadStart(n int, d time.Duration) {
+	r.infoM.Lock()
+	defer r.infoM.Unlock()
+
+	r.head = nil
+	if n <= 0 && d <= 0 {
+		return
+	}
+
+	r.head = &headStart{d: d}
+	if n > 0 {
+		r.head.bytes = r.consumed.Load() + int64(n)
+	}
+}
+
+//headRoom returns how many of the next max bytes may bypass the limit.
+func (r *Reader) headRoom(max int) int {
+	r.infoM.Lock()
+	defer r.infoM.Unlock()
+
+	h := r.head
+	if h == nil {
+		return 0
+	}
+
+	if h.started.IsZero() {
+		h.started = time.Now()
+	}
+	if h.d > 0 && time.Since(h.started) >= h.d {
+		r.head = nil
+		return 0
+	}
+	if h.bytes > 0 {
+		left := h.bytes - r.consumed.Load()
+		if left <= 0 {
+			r.head = nil
+			return 0
+		}
+		return int(min(int64(max), left))
+	}
+	return max
+}
+
+//OnProgress calls fn with the Progress of the Reader every interval, even
+//while a Read is waiting for its limit, and once more when it reaches EOF.
+//total is the number of bytes expected, or 0 if it is not known. Rates are
+//measured from the call. fn is called from the Reader's own goroutine and
+//from Read, so it should return quickly. A nil fn stops reporting.
+func (r *Reader) OnProgress(every time.Duration, total int64, fn func(Progress)) {
+	if fn == nil || every <= 0 {
+		r.meter.Store(nil)
+	} else {
+		r.meter.Store(newMeter(every, total, r.consumed.Load(), fn))
+	}
+
+	select {
+	case r.metered <- struct{}{}:
+	default:
+	}
+}
+
+//SetName assigns a human-readable name to the Reader, used by Describe.
+func (r *Reader) SetName(name string) {
+	r.infoM.Lock()
+	r.name = name
+	r.infoM.Unlock()
+}
+
+//Name returns the name assigned with SetName.
+func (r *Reader) Name() string {
+	r.infoM.Lock()
+	defer r.infoM.Unlock()
+	return r.name
+}
+
+//Describe implements the limio.Describer interface.
+func (r *Reader) Describe() Snapshot {
+	r.limitedM.RLock()
+	limited := r.limited
+	r.limitedM.RUnlock()
+
+	r.infoM.Lock()
+	defer r.infoM.Unlock()
+
+	s := Snapshot{
+		Name:    r.name,
+		Kind:    "reader",
+		Limited: limited,
+		Stats: Stats{
+			Allocated: r.allocated.Load(),
+			Consumed:  r.consumed.Load(),
+			HeadStart: r.headRead.Load(),
+		},
+	}
+	if r.conf != nil {
+		c := *r.conf
+		s.Rate = &c
+	}
+	return s
+}
+
+//Demand implements the limio.Demander interface. It returns the number of
+//bytes a Read in progress is still waiting to fill, or 0 if no Read is in
+//progress.
+func (r *Reader) Demand() int {
+	return int(r.demand.Load())
+}
+
+//receive gets a grant from run(), only waiting if nothing has been read yet
+//(wrote is false), until timeLimit (if positive) passes or the Reader is
+//closed.
+func (r *Reader) receive(wrote bool, timeLimit time.Duration) (int, error) {
+	select {
+	case lim := <-r.rate:
+		return lim, nil
+	default:
+	}
+	if wrote {
+		return 0, nil
+	}
+
+	var timeout <-chan time.Time
+	if timeLimit > 0 {
+		t := time.NewTimer(timeLimit)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case lim := <-r.rate:
+		return lim, nil
+	case <-timeout:
+		return 0, ErrTimeoutExceeded
+	case <-r.closed:
+		return 0, ErrClosed
+	}
+}
+
+//refund keeps tokens that were granted but not spent. Tokens taken from a
+//Bucket go back to it, and tokens from a limit with a refund function (such as
+//a SimpleManager's) are handed back through it, so that others sharing the
+//limit can use them; any other tokens are carried over to the next Read, as
+//long as the limit has not changed in the meantime.
+func (r *Reader) refund(b *Bucket, to func(int), changed chan struct{}, unused int) {
+	if unused <= 0 {
+		return
+	}
+
+	switch {
+	case b != nil:
+		b.Put(unused)
+		r.allocated.Add(-int64(unused))
+		return
+	case to != nil:
+		to(unused)
+		r.allocated.Add(-int64(unused))
+		return
+	}
+
+	r.balance += unused
+	r.balanceFor = changed
+}
+
+//takeBucket takes up to max tokens from b, only waiting for them if nothing
+//has been read yet.
+func (r *Reader) takeBucket(b *Bucket, changed <-chan struct{}, max int, wrote bool) (int, error) {
+	r.timeoutM.Lock()
+	timeLimit := r.timeout
+	r.timeoutM.Unlock()
+
+	return takeForRead(b, changed, max, wrote, timeLimit)
+}
+
+//takeForRead takes up to max tokens from b on behalf of a Read. It only waits
+//if nothing has been read yet (wrote is false), until changed is closed or
+//timeLimit (if positive) passes.
+func takeForRead(b *Bucket, changed <-chan struct{}, max int, wrote bool, timeLimit time.Duration) (int, error) {
+	if n := b.TryTake(max); n > 0 || wrote {
+		return n, nil
+	}
+
+	var timeout <-chan time.Time
+	if timeLimit > 0 {
+		t := time.NewTimer(timeLimit)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	return b.take(max, changed, timeout)
+}
+
+//setLimited must only be called from run(). It also wakes any Read waiting on
+//a Bucket so that it observes the new limit.
+func (r *Reader) setLimited(limited bool, b *Bucket, refund func(int)) {
+	r.limitedM.Lock()
+	r.limited = limited
+	r.bucket = b
+	r.refundTo = refund
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.limitedM.Unlock()
+}
+
 func (r *Reader) sendIfReady(i int) {
 	select {
 	case r.rate <- i:
@@ -176,6 +585,12 @@ func (r *Reader) sendIfReady(i int) {
 //return a limio.TimedOut error if the timeout is exceeded while waiting for a
 //read operation.
 func (r *Reader) SetTimeout(t time.Duration) error {
+	select {
+	case <-r.closed:
+		return ErrClosed
+	default:
+	}
+
 	r.timeoutM.Lock()
 	r.timeout = t
 	r.timeoutM.Unlock()
@@ -187,53 +602,76 @@ func (r *Reader) run() {
 	currLim := &limit{}
 
 	rateTicker := &time.Ticker{}
+	var rm *ramping
+	progressTicker := &time.Ticker{}
 
 	//This loop is important for serializing access to the limits and the
 	//io.Reader being managed
 	for {
 		select {
-		case <-r.cls:
-			r.limitedM.Lock()
-			r.limited = false
-			r.limitedM.Unlock()
+		case <-r.closed:
+			r.setLimited(false, nil, nil)
 
 			rateTicker.Stop()
-			go notify(currLim.done, true)
-
-			close(r.newLimit)
-			close(r.used)
-			close(r.rate)
+			progressTicker.Stop()
+			notify(currLim.done, true)
+			close(r.stopped)
 
 			return
-		case l := <-currLim.lim:
+		case l, ok := <-currLim.lim:
+			if !ok {
+				//The source of the limit has gone away (e.g. we were
+				//unmanaged), so there is nothing left to enforce.
+				glog.V(9).Info("Reader limit channel closed; unlimiting")
+				go notify(currLim.done, false)
+				currLim, rm = &limit{}, nil
+				r.setLimited(false, nil, nil)
+
+				r.sendIfReady(0) //Unlock any readers waiting for a value
+				continue
+			}
 			r.sendIfReady(l)
-		case <-rateTicker.C:
-			r.sendIfReady(currLim.rate.n)
+		case now := <-rateTicker.C:
+			n := currLim.rate.n
+			if rm != nil {
+				n = rm.next(now, currLim.rate.t)
+				if rm.done(now) {
+					rm = nil
+				}
+			}
+			r.sendIfReady(n)
+		case <-progressTicker.C:
+			if m := r.meter.Load(); m != nil {
+				m.report(r.consumed.Load(), false)
+			}
+		case <-r.metered:
+			progressTicker.Stop()
+			progressTicker = &time.Ticker{}
+			if m := r.meter.Load(); m != nil {
+				progressTicker = time.NewTicker(m.every)
+			}
 		case l := <-r.newLimit:
 			glog.V(9).Infof("Reader got a new limit: %#v", l)
 			go notify(currLim.done, false)
 			rateTicker.Stop()
-			currLim = &limit{}
+			prev, prm := currLim, rm
+			currLim, rm = &limit{}, nil
 
-			if l != nil {
+			if !l.unlimited() {
 				currLim = l
-				r.limitedM.Lock()
-				r.limited = true
-				r.limitedM.Unlock()
+				r.setLimited(true, l.bucket, l.refund)
 
 				if currLim.rate != emptyRate && currLim.rate.n != 0 {
-					currLim.rate.n, currLim.rate.t = Distribute(currLim.rate.n, currLim.rate.t, DefaultWindow)
+					currLim.rate.n, currLim.rate.t = Distribute(currLim.rate.n, currLim.rate.t, currLim.window)
 					rateTicker = time.NewTicker(currLim.rate.t)
+					rm = startRamp(prev, prm, currLim, time.Now())
 				}
-
-				close(l.ready)
 			} else {
-				r.limitedM.Lock()
-				r.limited = false
-				r.limitedM.Unlock()
+				r.setLimited(false, nil, nil)
 
-				r.rate <- 0 //Unlock any readers waiting for a value
+				r.sendIfReady(0) //Unlock any readers waiting for a value
 			}
+			close(l.ready)
 		}
 	}
 }
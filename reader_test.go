@@ -233,26 +233,96 @@ func TestClose(t *testing.T) {
 	r := NewReader(strings.NewReader(testText))
 
 	ch := make(chan int, 1)
-	r.Limit(ch)
+	done := r.Limit(ch)
 	err := r.Close()
 
 	if err != nil {
 		t.Fatalf("Close did not work: %v", err)
 	}
 
+	if fin := <-done; !fin {
+		t.Errorf("Close did not report finality to the limit's owner")
+	}
+
 	p := make([]byte, len(testText))
 
 	n, err := r.Read(p)
 
-	if n != len(p) {
-		t.Errorf("Wrong number of bytes reported read: %d", n)
+	if n != 0 || err != ErrClosed {
+		t.Errorf("Read after Close returned %d, %v", n, err)
 	}
 
-	if err != nil && err != io.EOF {
-		t.Errorf("Non-EOF error reported for closed limiter: %v", err)
+	if err := r.Close(); err != ErrClosed {
+		t.Errorf("Second Close returned %v", err)
 	}
 }
 
+func TestCloseLifecycle(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	r.Limit(make(chan int))
+
+	read := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 10))
+		read <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	asrt.NoError(r.Close())
+
+	select {
+	case err := <-read:
+		asrt.Equal(ErrClosed, err, "a blocked Read should be interrupted")
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock Read")
+	}
+
+	//Nothing may panic after Close
+	asrt.True(<-r.SimpleLimit(KB, time.Second))
+	asrt.True(<-r.SimpleLimitBurst(KB, time.Second, KB))
+	asrt.True(<-r.Limit(make(chan int)))
+	asrt.True(<-r.LimitBucket(NewBucket()))
+	r.Unlimit()
+	asrt.Equal(ErrClosed, r.SetTimeout(time.Second))
+	asrt.False(r.Describe().Limited)
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed++
+	return io.ErrUnexpectedEOF
+}
+
+func TestNewReadCloser(t *testing.T) {
+	asrt := assert.New(t)
+
+	rc := &closeRecorder{Reader: strings.NewReader(testText)}
+	r := NewReadCloser(rc)
+
+	asrt.Equal(io.ErrUnexpectedEOF, r.Close())
+	asrt.Equal(ErrClosed, r.Close())
+	asrt.Equal(1, rc.closed)
+}
+
+func TestReaderTimeout(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+
+	r.Limit(make(chan int))
+	r.SetTimeout(10 * time.Millisecond)
+
+	_, err := r.Read(make([]byte, 10))
+	asrt.Equal(ErrTimeoutExceeded, err)
+}
+
 func TestDualLimit(t *testing.T) {
 	r := NewReader(strings.NewReader(testText))
 
@@ -292,6 +362,104 @@ func TestDualLimit(t *testing.T) {
 
 }
 
+//chunkReader returns at most max bytes per Read, like a socket with little
+//data buffered.
+type chunkReader struct {
+	r   io.Reader
+	max int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.max {
+		p = p[:c.max]
+	}
+	return c.r.Read(p)
+}
+
+func TestRefund(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(&chunkReader{strings.NewReader(testText), 10})
+	defer r.Close()
+
+	c := make(chan int, 1)
+	r.Limit(c)
+	c <- 100
+
+	p := make([]byte, 25)
+	total := 0
+	for total < 100 {
+		n, err := r.Read(p)
+		asrt.NoError(err)
+		total += n
+	}
+	asrt.Equal(100, total, "every granted token should be spent")
+
+	//Tokens from a shared Bucket go back to it
+	b := NewBucket()
+	b.SetFed()
+	b.Put(100)
+	r.LimitBucket(b)
+
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(25, n)
+	asrt.Equal(75, b.TryTake(1000))
+
+	//As do tokens from a limit that takes refunds
+	refunded := make(chan int, 1)
+	r.LimitRefund(c, func(n int) { refunded <- n })
+	c <- 100
+
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(10, n)
+	asrt.Equal(90, <-refunded)
+
+	//Which a SimpleManager hands out again
+	lm := newSimpleManager()
+	lm.refund(40)
+	asrt.Equal(50, lm.distribute(10))
+	asrt.Equal(10, lm.distribute(10))
+}
+
+func TestHeadStart(t *testing.T) {
+	asrt := assert.New(t)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+
+	//No tokens are ever sent, so only the head start can be read
+	r.Limit(make(chan int))
+	r.SetHeadStart(100, 0)
+	r.SetTimeout(20 * time.Millisecond)
+
+	p := make([]byte, 150)
+	n, err := r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(100, n)
+
+	_, err = r.Read(p)
+	asrt.Equal(ErrTimeoutExceeded, err)
+
+	s := r.Describe().Stats
+	asrt.EqualValues(100, s.HeadStart)
+	asrt.EqualValues(100, s.Consumed)
+	asrt.Zero(s.Allocated)
+
+	//A head start by time starts with the next Read
+	r.SetHeadStart(0, 30*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	n, err = r.Read(p)
+	asrt.NoError(err)
+	asrt.Equal(150, n)
+
+	time.Sleep(40 * time.Millisecond)
+	_, err = r.Read(p)
+	asrt.Equal(ErrTimeoutExceeded, err)
+	asrt.EqualValues(250, r.Describe().Stats.HeadStart)
+}
+
 func ExampleReader() {
 	slowCopy := func(w io.Writer, r io.Reader) error {
 		lr := NewReader(r)
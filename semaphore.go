@@ -0,0 +1,409 @@
+package limio
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+//An Acquirer grants permission for operations to take place. Each call to
+//Acquire that succeeds returns a function that must be called once the
+//operations are over.
+type Acquirer interface {
+	Acquire(ctx context.Context, n int) (release func(), err error)
+}
+
+//AllOf returns an Acquirer that acquires from each of as in turn, so that
+//operations must satisfy all of them, such as both a rate limit (a Bucket) and
+//a concurrency limit (a Semaphore). If any Acquire fails, those that succeeded
+//are released.
+func AllOf(as ...Acquirer) Acquirer {
+	return allOf(as)
+}
+
+type allOf []Acquirer
+
+func (all allOf) Acquire(ctx context.Context, n int) (func(), error) {
+	releases := make([]func(), 0, len(all))
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, a := range all {
+		r, err := a.Acquire(ctx, n)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
+
+//ErrTooManySlots is returned by Semaphore.Acquire for more slots than the
+//Semaphore has.
+var ErrTooManySlots = errors.New("more slots asked for than the semaphore has")
+
+//A Semaphore limits how many operations may be in flight at once. Unlike the
+//tokens of a rate, its slots are returned once an operation is over.
+//
+//A Semaphore is a SlotLimiter, so a SlotManager can divide slots among the
+//Semaphores of several tenants. It is also a Limiter, whose tokens, as for any
+//other Limiter, are spent: each lets one more slot be acquired, so a Manager
+//can limit the rate at which operations start as well as how many are in
+//flight. A Semaphore reports the slots it is using and waiting for as its
+//Demand, so a DemandManager shares its tokens according to use.
+//
+//A Semaphore is safe for concurrent use.
+type Semaphore struct {
+	mu sync.Mutex
+
+	closed  bool
+	slots   int //negative if there is no limit on slots
+	inUse   int
+	waiters *list.List
+	name    string
+
+	//rated is set while the Semaphore is limited by a token channel, from
+	//which credit holds the tokens not yet spent on acquiring slots.
+	rated  bool
+	credit int
+	feed   chan struct{}
+
+	done      chan<- bool //reports on the token limit
+	slotsDone chan<- bool //reports on the slot limit
+
+	acquired int64
+	released int64
+}
+
+type semWaiter struct {
+	n   int
+	ch  chan struct{}
+	err error //set before ch is closed
+}
+
+//NewSemaphore returns a Semaphore with the given number of slots, or one with
+//no limit on slots if slots is below one.
+func NewSemaphore(slots int) *Semaphore {
+	s := &Semaphore{
+		slots:   -1,
+		waiters: list.New(),
+	}
+	if slots > 0 {
+		s.SetSlots(slots)
+	}
+	return s
+}
+
+//SetSlots implements the limio.SlotLimiter interface, limiting the Semaphore
+//to n operations in flight at once, or removing the limit if n is negative.
+//Lowering the number of slots does not interrupt operations already in
+//flight.
+func (s *Semaphore) SetSlots(n int) <-chan bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return finished()
+	}
+	s.slots = max(n, -1)
+	s.serve()
+
+	notify(s.slotsDone, false)
+	done := make(chan bool, 1)
+	s.slotsDone = done
+	return done
+}
+
+//Limit implements the limio.Limiter interface. Each token received on l lets
+//one more slot be acquired. Tokens not yet spent are kept, up to twice the
+//latest grant (or the slots the first waiting Acquire needs, if more).
+func (s *Semaphore) Limit(l chan int) <-chan bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return finished()
+	}
+	s.stopFeed()
+	//Nothing more may start until the first tokens arrive
+	s.rated, s.credit = true, 0
+
+	stop := make(chan struct{})
+	s.feed = stop
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case n, ok := <-l:
+				if !ok {
+					s.feedClosed(stop)
+					return
+				}
+
+				s.mu.Lock()
+				s.addCredit(n)
+				s.mu.Unlock()
+			}
+		}
+	}()
+
+	notify(s.done, false)
+	done := make(chan bool, 1)
+	s.done = done
+	return done
+}
+
+//Unlimit implements the limio.Limiter interface, removing the limit set by
+//Limit. The number of slots, if set, still applies.
+func (s *Semaphore) Unlimit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unlimit()
+}
+
+//NOTE must ONLY be called with mu held.
+func (s *Semaphore) unlimit() {
+	s.stopFeed()
+	s.rated, s.credit = false, 0
+	notify(s.done, false)
+	s.done = nil
+	s.serve()
+}
+
+//feedClosed unlimits s when the channel fed by stop is closed, unless a newer
+//limit has replaced it already.
+func (s *Semaphore) feedClosed(stop chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.feed == stop {
+		s.unlimit()
+	}
+}
+
+//Acquire implements the limio.Acquirer interface, waiting until n slots are
+//free. Waiting operations are served in the order they arrived. It returns
+//ctx.Err() if ctx is done first, ErrClosed if the Semaphore is closed, or
+//ErrTooManySlots if n is more than the Semaphore has (or is left with by
+//SetSlots while waiting), as those could never be acquired.
+func (s *Semaphore) Acquire(ctx context.Context, n int) (func(), error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if s.tooMany(n) {
+		s.mu.Unlock()
+		return nil, ErrTooManySlots
+	}
+
+	if s.waiters.Len() == 0 && s.fits(n) {
+		s.grant(n)
+		s.mu.Unlock()
+		return s.releaser(n), nil
+	}
+
+	w := &semWaiter{n: n, ch: make(chan struct{})}
+	e := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ch:
+		return s.woken(w)
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-w.ch:
+		//Woken concurrently with the cancelation
+		return s.woken(w)
+	default:
+	}
+	s.waiters.Remove(e)
+	//Those behind us may fit now
+	s.serve()
+	return nil, ctx.Err()
+}
+
+//woken returns the result of a wait that ended with w being granted its slots
+//or failed.
+func (s *Semaphore) woken(w *semWaiter) (func(), error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return s.releaser(w.n), nil
+}
+
+//TryAcquire takes n slots if they are free right now.
+func (s *Semaphore) TryAcquire(n int) (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.waiters.Len() > 0 || !s.fits(n) {
+		return nil, false
+	}
+	s.grant(n)
+	return s.releaser(n), true
+}
+
+//Slots returns the number of slots the Semaphore has, or -1 if there is no
+//limit on slots.
+func (s *Semaphore) Slots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slots
+}
+
+//InUse returns the number of slots currently acquired.
+func (s *Semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inUse
+}
+
+//Demand implements the limio.Demander interface, returning the slots in use
+//and waited for.
+func (s *Semaphore) Demand() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.inUse
+	for e := s.waiters.Front(); e != nil; e = e.Next() {
+		n += e.Value.(*semWaiter).n
+	}
+	return n
+}
+
+//SetName assigns a human-readable name to the Semaphore, used by Describe.
+func (s *Semaphore) SetName(name string) {
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+//Describe implements the limio.Describer interface. Allocated counts slots
+//acquired, and Consumed slots released.
+func (s *Semaphore) Describe() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Snapshot{
+		Name:    s.name,
+		Kind:    "semaphore",
+		Limited: s.rated || s.slots >= 0,
+		Stats: Stats{
+			Allocated: s.acquired,
+			Consumed:  s.released,
+		},
+	}
+}
+
+//Close fails every waiting and future Acquire with ErrClosed and reports to
+//the Semaphore's parent that it has shut down. Operations in flight may still
+//release their slots. Closing more than once returns ErrClosed.
+func (s *Semaphore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+	s.stopFeed()
+
+	for e := s.waiters.Front(); e != nil; e = s.waiters.Front() {
+		s.waiters.Remove(e)
+		w := e.Value.(*semWaiter)
+		w.err = ErrClosed
+		close(w.ch)
+	}
+	notify(s.done, true)
+	notify(s.slotsDone, true)
+	s.done, s.slotsDone = nil, nil
+	return nil
+}
+
+func (s *Semaphore) releaser(n int) func() {
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.inUse -= n
+			s.released += int64(n)
+			s.serve()
+		})
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+//addCredit keeps n tokens received on the limit channel.
+func (s *Semaphore) addCredit(n int) {
+	if n <= 0 {
+		return
+	}
+	limit := 2 * n
+	if e := s.waiters.Front(); e != nil {
+		limit = max(limit, e.Value.(*semWaiter).n)
+	}
+	s.credit = min(s.credit+n, limit)
+	s.serve()
+}
+
+//NOTE must ONLY be called with mu held.
+func (s *Semaphore) fits(n int) bool {
+	if s.rated && s.credit < n {
+		return false
+	}
+	return s.slots < 0 || s.inUse+n <= s.slots
+}
+
+//NOTE must ONLY be called with mu held.
+func (s *Semaphore) grant(n int) {
+	s.inUse += n
+	s.acquired += int64(n)
+	if s.rated {
+		s.credit -= n
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+//serve wakes waiters in order while their slots are free, failing those that
+//want more slots than there are rather than leaving them to block the rest.
+func (s *Semaphore) serve() {
+	for e := s.waiters.Front(); e != nil; e = s.waiters.Front() {
+		w := e.Value.(*semWaiter)
+		switch {
+		case s.tooMany(w.n):
+			w.err = ErrTooManySlots
+		case s.fits(w.n):
+			s.grant(w.n)
+		default:
+			return
+		}
+		s.waiters.Remove(e)
+		close(w.ch)
+	}
+}
+
+//NOTE must ONLY be called with mu held.
+func (s *Semaphore) tooMany(n int) bool {
+	return s.slots >= 0 && n > s.slots
+}
+
+//NOTE must ONLY be called with mu held.
+func (s *Semaphore) stopFeed() {
+	if s.feed != nil {
+		close(s.feed)
+		s.feed = nil
+	}
+}
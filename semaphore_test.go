@@ -0,0 +1,211 @@
+package limio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphore(t *testing.T) {
+	asrt := assert.New(t)
+
+	s := NewSemaphore(2)
+	defer s.Close()
+	asrt.Implements((*Limiter)(nil), s)
+	asrt.Implements((*Acquirer)(nil), s)
+	asrt.Equal(2, s.Slots())
+	asrt.Equal(-1, NewSemaphore(0).Slots())
+
+	ctx := context.Background()
+	r1, err := s.Acquire(ctx, 1)
+	asrt.NoError(err)
+	r2, err := s.Acquire(ctx, 1)
+	asrt.NoError(err)
+	_, ok := s.TryAcquire(1)
+	asrt.False(ok)
+
+	got := make(chan func())
+	go func() {
+		r, _ := s.Acquire(ctx, 2)
+		got <- r
+	}()
+	for s.Demand() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//Releasing twice only frees the slot once
+	r1()
+	r1()
+	asrt.Equal(1, s.InUse())
+	r2()
+	r3 := <-got
+	asrt.Equal(2, s.InUse())
+
+	//Canceled waits give up their place
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(cctx, 1)
+	asrt.Equal(context.DeadlineExceeded, err)
+	asrt.Equal(2, s.Demand())
+
+	r3()
+	st := s.Describe()
+	asrt.Equal("semaphore", st.Kind)
+	asrt.Equal(int64(4), st.Stats.Allocated)
+	asrt.Equal(int64(4), st.Stats.Consumed)
+
+	//Acquiring more slots than there are fails rather than waiting forever
+	_, err = s.Acquire(ctx, 3)
+	asrt.Equal(ErrTooManySlots, err)
+	r4, err := s.Acquire(ctx, 2)
+	asrt.NoError(err)
+	errs := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx, 2)
+		errs <- err
+	}()
+	for s.Demand() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	s.SetSlots(1)
+	asrt.Equal(ErrTooManySlots, <-errs)
+	r4()
+}
+
+func TestSemaphoreManaged(t *testing.T) {
+	asrt := assert.New(t)
+
+	sm := NewSlotManager()
+	defer sm.Close()
+
+	a, b := NewSemaphore(0), NewSemaphore(0)
+	asrt.Implements((*SlotLimiter)(nil), a)
+	asrt.NoError(sm.Manage(a))
+	asrt.NoError(sm.Manage(b))
+	asrt.NoError(sm.SetWeight(b, 3))
+	asrt.Equal(-1, a.Slots())
+
+	//Slots are divided by weight, with the remainder going to the first
+	sm.SetSlots(9)
+	asrt.Equal(3, a.Slots())
+	asrt.Equal(6, b.Slots())
+	for i := 0; i < 3; i++ {
+		_, ok := a.TryAcquire(1)
+		asrt.True(ok)
+	}
+	_, ok := a.TryAcquire(1)
+	asrt.False(ok)
+	_, ok = b.TryAcquire(6)
+	asrt.True(ok)
+
+	//Every member gets a slot while there are enough to go round
+	asrt.NoError(sm.SetWeight(a, 9))
+	asrt.NoError(sm.SetWeight(b, 1))
+	sm.SetSlots(3)
+	asrt.Equal(2, a.Slots())
+	asrt.Equal(1, b.Slots())
+	asrt.NoError(sm.SetWeight(a, 1))
+	asrt.NoError(sm.SetWeight(b, 3))
+	sm.SetSlots(9)
+
+	//Closing a tenant removes it from its parent, and the others get its
+	//slots
+	done := make(chan struct{})
+	go func() {
+		_, err := a.Acquire(context.Background(), 1)
+		asrt.Equal(ErrClosed, err)
+		close(done)
+	}()
+	for a.Demand() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.NoError(a.Close())
+	<-done
+	for b.Slots() != 9 {
+		time.Sleep(time.Millisecond)
+	}
+	asrt.Len(sm.Describe().Children, 1)
+	asrt.Equal(ErrClosed, a.Close())
+
+	//Closing the manager lifts the limit
+	asrt.NoError(sm.Close())
+	asrt.Equal(-1, b.Slots())
+	asrt.Equal(ErrClosed, sm.Manage(a))
+}
+
+func TestSemaphoreTokens(t *testing.T) {
+	asrt := assert.New(t)
+
+	//Tokens from a Manager are spent on acquiring slots, as for any other
+	//Limiter, however many slots there are
+	lmr := NewSimpleManager()
+	defer lmr.Close()
+	ch := make(chan int)
+	lmr.Limit(ch)
+
+	s := NewSemaphore(10)
+	defer s.Close()
+	lmr.Manage(s)
+	for !Describe(lmr).Children[0].Limited {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, ok := s.TryAcquire(1)
+	asrt.False(ok, "nothing may start before tokens arrive")
+
+	ch <- 2
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		release, err := s.Acquire(ctx, 1)
+		asrt.NoError(err)
+		release()
+	}
+	_, ok = s.TryAcquire(1)
+	asrt.False(ok, "tokens are spent even though the slots were released")
+	asrt.Equal(10, s.Slots(), "tokens do not change the slots")
+
+	//Unlimiting leaves the slots in place
+	lmr.Unmanage(s)
+	for {
+		s.mu.Lock()
+		rated := s.rated
+		s.mu.Unlock()
+		if !rated {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	release, err := s.Acquire(ctx, 10)
+	asrt.NoError(err)
+	_, ok = s.TryAcquire(1)
+	asrt.False(ok)
+	release()
+}
+
+func TestAllOf(t *testing.T) {
+	asrt := assert.New(t)
+
+	sem := NewSemaphore(1)
+	b := NewBucket()
+	b.SetFed()
+	b.Put(3)
+
+	both := AllOf(b, sem)
+	ctx := context.Background()
+
+	release, err := both.Acquire(ctx, 1)
+	asrt.NoError(err)
+	asrt.Equal(1, sem.InUse())
+
+	//The rate allows it, but no slot is free
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = both.Acquire(cctx, 1)
+	asrt.Equal(context.DeadlineExceeded, err)
+
+	release()
+	asrt.Equal(0, sem.InUse())
+	asrt.Equal(1, b.TryTake(10), "rate tokens are spent, not returned")
+}
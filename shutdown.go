@@ -0,0 +1,144 @@
+package limio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+//ShutdownOptions control how a SimpleManager shuts down.
+type ShutdownOptions struct {
+	//Drain keeps enforcing the SimpleManager's limit until every managed
+	//Limiter has finished (reported that it shut down, as a Reader does when
+	//closed) or the context is done. Limiters that are not Finishers only
+	//report finishing while they are limited.
+	Drain bool
+
+	//Cascade shuts down nested Managers with the same options, and closes
+	//every other managed Limiter that is an io.Closer once draining is over.
+	Cascade bool
+}
+
+//A ShutdownError reports the managed Limiters, including those of nested
+//Managers when cascading, that were still active when a Shutdown's context
+//was done.
+type ShutdownError struct {
+	Err    error
+	Active []Limiter
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shutdown: %d limiters still active: %v", len(e.Active), e.Err)
+}
+
+//Unwrap returns the context's error.
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+//A Shutdowner is a Manager that can shut down gracefully, such as a
+//SimpleManager.
+type Shutdowner interface {
+	Shutdown(context.Context, ShutdownOptions) error
+}
+
+//Shutdown closes the SimpleManager gracefully. It immediately stops accepting
+//new Limiters, so Manage returns ErrClosed, then drains and cascades according
+//to opts before closing the SimpleManager as Close does. If ctx is done before
+//draining finishes, Shutdown returns a *ShutdownError listing the Limiters
+//that were still active.
+func (lm *SimpleManager) Shutdown(ctx context.Context, opts ShutdownOptions) error {
+	lm.closingOnce.Do(func() { close(lm.closing) })
+
+	var serr ShutdownError
+	if opts.Cascade {
+		serr.Active, serr.Err = lm.shutdownNested(ctx, opts)
+	}
+
+	if opts.Drain && !lm.drain(ctx) {
+		serr.Err = ctx.Err()
+		for _, l := range lm.state().children {
+			if _, ok := l.(Shutdowner); ok && opts.Cascade {
+				//Nested Managers have reported their own children
+				continue
+			}
+			serr.Active = append(serr.Active, l)
+		}
+	}
+
+	if opts.Cascade {
+		for _, l := range lm.state().children {
+			if _, ok := l.(Shutdowner); ok {
+				continue
+			}
+			if c, ok := l.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+
+	lm.Close()
+
+	if serr.Err != nil {
+		return &serr
+	}
+	return nil
+}
+
+//shutdownNested shuts down every managed Shutdowner concurrently, returning
+//what they reported as still active.
+func (lm *SimpleManager) shutdownNested(ctx context.Context, opts ShutdownOptions) ([]Limiter, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		active []Limiter
+		err    error
+	)
+
+	for _, l := range lm.state().children {
+		s, ok := l.(Shutdowner)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			e := s.Shutdown(ctx, opts)
+			if e == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if se, ok := e.(*ShutdownError); ok {
+				active = append(active, se.Active...)
+				e = se.Err
+			}
+			err = e
+		}()
+	}
+	wg.Wait()
+
+	return active, err
+}
+
+//drain waits until the SimpleManager has no managed Limiters left, returning
+//false if ctx is done first.
+func (lm *SimpleManager) drain(ctx context.Context) bool {
+	empty := make(chan struct{})
+	select {
+	case lm.drained <- empty:
+	case <-lm.closed:
+		return true
+	}
+
+	select {
+	case <-empty:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
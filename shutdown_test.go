@@ -0,0 +1,90 @@
+package limio
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownDrain(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	lmr.SimpleLimit(MB, time.Second)
+
+	r1 := lmr.NewReader(strings.NewReader(testText))
+	r2 := lmr.NewReader(strings.NewReader(testText))
+
+	res := make(chan error)
+	go func() {
+		res <- lmr.Shutdown(context.Background(), ShutdownOptions{Drain: true})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	asrt.Equal(ErrClosed, lmr.Manage(NewReader(strings.NewReader(""))))
+
+	//Limits are still enforced while draining
+	asrt.True(Describe(r1).Limited)
+
+	r1.Close()
+	select {
+	case <-res:
+		t.Fatal("Shutdown returned with a Limiter still active")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	r2.Close()
+	asrt.NoError(<-res)
+	asrt.Equal(ErrClosed, lmr.Close())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	asrt := assert.New(t)
+
+	lmr := NewSimpleManager()
+	lmr.SimpleLimit(MB, time.Second)
+
+	r := lmr.NewReader(strings.NewReader(testText))
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := lmr.Shutdown(ctx, ShutdownOptions{Drain: true})
+
+	var serr *ShutdownError
+	asrt.True(errors.As(err, &serr))
+	asrt.True(errors.Is(err, context.DeadlineExceeded))
+	asrt.Equal([]Limiter{r}, serr.Active)
+	asrt.False(Describe(r).Limited, "Limiters left over should be unlimited")
+}
+
+func TestShutdownCascade(t *testing.T) {
+	asrt := assert.New(t)
+
+	root, nested := NewSimpleManager(), NewSimpleManager()
+	root.SimpleLimit(MB, time.Second)
+	root.Manage(nested)
+
+	r1 := root.NewReader(strings.NewReader(testText))
+	r2 := nested.NewReader(strings.NewReader(testText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := root.Shutdown(ctx, ShutdownOptions{Drain: true, Cascade: true})
+
+	var serr *ShutdownError
+	asrt.True(errors.As(err, &serr))
+	asrt.ElementsMatch([]Limiter{r1, r2}, serr.Active)
+
+	_, err = r1.Read(make([]byte, 1))
+	asrt.Equal(ErrClosed, err)
+	_, err = r2.Read(make([]byte, 1))
+	asrt.Equal(ErrClosed, err)
+	asrt.Equal(ErrClosed, nested.Close())
+}
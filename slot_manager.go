@@ -0,0 +1,253 @@
+package limio
+
+import (
+	"errors"
+	"sync"
+)
+
+//A SlotLimiter is limited by how many slots it may have in use at once, rather
+//than by tokens to spend, such as a Semaphore. A negative number of slots
+//removes the limit. As for Limit, the channel returned by SetSlots reports
+//when the slots set are no longer in use, with true if the SlotLimiter has
+//shut down.
+type SlotLimiter interface {
+	SetSlots(n int) <-chan bool
+}
+
+//A SlotManager divides a number of slots among SlotLimiters, such as the
+//Semaphores of several tenants, in proportion to their weights. Unlike the
+//tokens a SimpleManager hands out, slots are not spent, so each member is only
+//given its share again when the total, the weights or the members change.
+//Slots that do not divide evenly go to the members that were managed first,
+//and every member is given at least one slot as long as there are enough to go
+//round. With fewer slots than members, those managed last are given none, so
+//a Semaphore among them fails every Acquire with ErrTooManySlots.
+//
+//A SlotManager is itself a SlotLimiter, so the slots of a tenant can in turn
+//be divided among its own members. Members that shut down are removed, and
+//members that are unmanaged, or whose SlotManager is closed, are left without
+//a limit on slots.
+//
+//A SlotManager is safe for concurrent use.
+type SlotManager struct {
+	mu      sync.Mutex
+	slots   int //negative if there is no limit on slots
+	members []*slotMember
+	closed  bool
+	done    chan<- bool
+	name    string
+}
+
+type slotMember struct {
+	l SlotLimiter
+	w int
+	n int //the slots last set
+}
+
+//NewSlotManager returns a SlotManager with no limit on slots.
+func NewSlotManager() *SlotManager {
+	return &SlotManager{slots: -1}
+}
+
+//SetSlots implements the limio.SlotLimiter interface, dividing n slots among
+//the members, or removing their limit if n is negative.
+func (sm *SlotManager) SetSlots(n int) <-chan bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return finished()
+	}
+	sm.slots = max(n, -1)
+	sm.divide()
+
+	notify(sm.done, false)
+	done := make(chan bool, 1)
+	sm.done = done
+	return done
+}
+
+//Slots returns the number of slots the SlotManager divides, or -1 if there is
+//no limit on slots.
+func (sm *SlotManager) Slots() int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.slots
+}
+
+//Manage adds l to the members among which the slots are divided, with a
+//weight of 1.
+func (sm *SlotManager) Manage(l SlotLimiter) error {
+	if l == SlotLimiter(sm) {
+		return errors.New("a manager cannot manage itself.")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return ErrClosed
+	}
+	if sm.member(l) >= 0 {
+		return nil
+	}
+	sm.members = append(sm.members, &slotMember{l: l, w: 1, n: -2})
+	sm.divide()
+	return nil
+}
+
+//Unmanage removes l from the members, leaving it without a limit on slots.
+func (sm *SlotManager) Unmanage(l SlotLimiter) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	i := sm.member(l)
+	if i < 0 {
+		return
+	}
+	sm.members = append(sm.members[:i], sm.members[i+1:]...)
+	l.SetSlots(-1)
+	sm.divide()
+}
+
+//SetWeight sets the relative share of the slots that l will receive.
+func (sm *SlotManager) SetWeight(l SlotLimiter, w int) error {
+	if w < 1 {
+		return errors.New("weight must be positive")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return ErrClosed
+	}
+	i := sm.member(l)
+	if i < 0 {
+		return ErrNotManaged
+	}
+	sm.members[i].w = w
+	sm.divide()
+	return nil
+}
+
+//SetName assigns a human-readable name to the SlotManager, used by Describe.
+func (sm *SlotManager) SetName(name string) {
+	sm.mu.Lock()
+	sm.name = name
+	sm.mu.Unlock()
+}
+
+//Describe implements the limio.Describer interface. Members that are not
+//Describers are described by their type only.
+func (sm *SlotManager) Describe() Snapshot {
+	return sm.describeTree(describing{})
+}
+
+func (sm *SlotManager) describeTree(path describing) Snapshot {
+	if !path.enter(sm) {
+		return Snapshot{Kind: "slot-manager", Cycle: true}
+	}
+	defer delete(path, sm)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	s := Snapshot{
+		Name:    sm.name,
+		Kind:    "slot-manager",
+		Limited: sm.slots >= 0,
+	}
+	for _, m := range sm.members {
+		c := path.describe(m.l)
+		c.Weight = m.w
+		s.Children = append(s.Children, c)
+	}
+	return s
+}
+
+//Close leaves every member without a limit on slots and reports to the
+//SlotManager's parent that it has shut down. Afterwards Manage and SetWeight
+//return ErrClosed. Closing more than once returns ErrClosed.
+func (sm *SlotManager) Close() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return ErrClosed
+	}
+	sm.closed = true
+	for _, m := range sm.members {
+		m.l.SetSlots(-1)
+	}
+	sm.members = nil
+	notify(sm.done, true)
+	sm.done = nil
+	return nil
+}
+
+//NOTE must ONLY be called with mu held.
+func (sm *SlotManager) member(l SlotLimiter) int {
+	for i, m := range sm.members {
+		if m.l == l {
+			return i
+		}
+	}
+	return -1
+}
+
+//NOTE must ONLY be called with mu held.
+//divide gives each member its share of the slots, if it has changed.
+func (sm *SlotManager) divide() {
+	shares := make([]int, len(sm.members))
+	if sm.slots < 0 {
+		for i := range shares {
+			shares[i] = -1
+		}
+	} else if len(sm.members) > 0 {
+		sum := 0
+		for _, m := range sm.members {
+			sum += m.w
+		}
+		left := sm.slots
+		for i, m := range sm.members {
+			shares[i] = sm.slots * m.w / sum
+			left -= shares[i]
+		}
+		for i := 0; left > 0; i++ {
+			shares[i]++
+			left--
+		}
+		//Take slots from the largest shares for members left with none
+		for i := range shares {
+			if shares[i] > 0 {
+				continue
+			}
+			j := 0
+			for k := range shares {
+				if shares[k] > shares[j] {
+					j = k
+				}
+			}
+			if shares[j] <= 1 {
+				break
+			}
+			shares[j]--
+			shares[i]++
+		}
+	}
+
+	for i, m := range sm.members {
+		if shares[i] == m.n {
+			continue
+		}
+		m.n = shares[i]
+		done := m.l.SetSlots(m.n)
+		go func(l SlotLimiter) {
+			//If `true` passed on channel, the member has shut down
+			if <-done {
+				sm.Unmanage(l)
+			}
+		}(m.l)
+	}
+}
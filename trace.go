@@ -0,0 +1,280 @@
+package limio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//MahimahiPacketSize is the number of bytes each line of a Mahimahi trace lets
+//through.
+var MahimahiPacketSize = 1500
+
+//A Trace is a recorded sequence of delivery opportunities, such as the
+//throughput of a real mobile network, that can be replayed with a
+//TraceSource.
+type Trace struct {
+	//Events are in order of their offset from the start of the trace.
+	Events []TraceEvent
+	//Period is how long the trace lasts before repeating when looped. Parsed
+	//traces, like Mahimahi, use the offset of the last event.
+	Period time.Duration
+}
+
+//A TraceEvent is an opportunity to deliver N tokens, At some offset from the
+//start of a Trace.
+type TraceEvent struct {
+	At time.Duration
+	N  int
+}
+
+//ErrInvalidTrace is returned when a trace cannot be parsed.
+var ErrInvalidTrace = errors.New("invalid trace")
+
+//add appends an event, merging it with the last one if they coincide.
+func (t *Trace) add(at time.Duration, n int) error {
+	if l := len(t.Events); l > 0 {
+		last := &t.Events[l-1]
+		if at < last.At {
+			return fmt.Errorf("%w: %s comes after %s", ErrInvalidTrace, at, last.At)
+		}
+		if at == last.At {
+			last.N += n
+			return nil
+		}
+	}
+	t.Events = append(t.Events, TraceEvent{At: at, N: n})
+	return nil
+}
+
+func (t *Trace) finish() (*Trace, error) {
+	if len(t.Events) == 0 {
+		return nil, fmt.Errorf("%w: no events", ErrInvalidTrace)
+	}
+	t.Period = t.Events[len(t.Events)-1].At
+	return t, nil
+}
+
+//ParseMahimahi parses a Mahimahi trace, in which each line is a timestamp in
+//milliseconds at which one packet of MahimahiPacketSize bytes may be
+//delivered.
+func ParseMahimahi(r io.Reader) (*Trace, error) {
+	t := &Trace{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("%w: line %d: bad timestamp %q", ErrInvalidTrace, line, s)
+		}
+		if err := t.add(time.Duration(ms)*time.Millisecond, MahimahiPacketSize); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return t.finish()
+}
+
+//ParseTraceCSV parses a trace of "time,bytes" records. Times are offsets from
+//the start of the trace, given either as a duration such as "1.5s" or as a
+//number of milliseconds. Bytes may use a size suffix (see ParseSize). A first
+//line whose time does not start like a number is taken to be a header and
+//skipped.
+func ParseTraceCSV(r io.Reader) (*Trace, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	t := &Trace{}
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTrace, err)
+		}
+
+		if line == 1 && isHeader(rec[0]) {
+			continue
+		}
+		at, err := parseOffset(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: bad time %q", ErrInvalidTrace, line, rec[0])
+		}
+		n, err := ParseSize(rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := t.add(at, n); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return t.finish()
+}
+
+//isHeader reports whether the time field of the first CSV record is a column
+//name rather than a (possibly malformed) time.
+func isHeader(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || !strings.ContainsRune("0123456789.+-", rune(s[0]))
+}
+
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		//Also rules out NaN, infinities and offsets a Duration cannot hold
+		if !(ms >= 0 && ms < float64(math.MaxInt64/int64(time.Millisecond))) {
+			return 0, ErrInvalidTrace
+		}
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = ErrInvalidTrace
+	}
+	return d, err
+}
+
+//ReadTrace reads a trace file, as CSV if its name ends in ".csv" and as a
+//Mahimahi trace otherwise.
+func ReadTrace(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ParseTraceCSV(f)
+	}
+	return ParseMahimahi(f)
+}
+
+//A TraceSource replays a Trace in real time as a stream of tokens suitable for
+//handing to any Limiter's Limit method, so that Readers and Managers can be
+//driven by a real-world trace.
+type TraceSource struct {
+	//C receives the tokens of each event in the Trace when it falls due.
+	//Events that fall due while a previous grant is waiting to be received
+	//are merged into a single grant. C is closed once the TraceSource has
+	//finished, which unlimits any Limiter it was limiting.
+	C chan int
+
+	t    *Trace
+	loop bool
+
+	clsOnce *sync.Once
+	cls     chan struct{}
+	done    chan struct{}
+}
+
+//NewTraceSource starts replaying t on C, from the beginning, repeating it
+//every t.Period if loop is true. Close should be called once the source is no
+//longer needed.
+//
+//The start of each repetition coincides with the end of the one before, so
+//when a trace with an event at offset 0 lasts exactly until its last event
+//(as parsed traces do), the event at 0 is only delivered the first time
+//round; thereafter the last event stands for both.
+func NewTraceSource(t *Trace, loop bool) *TraceSource {
+	s := TraceSource{
+		C:       make(chan int),
+		t:       t,
+		loop:    loop && t.Period > 0,
+		clsOnce: &sync.Once{},
+		cls:     make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return &s
+}
+
+func (s *TraceSource) run() {
+	defer close(s.done)
+	defer close(s.C)
+
+	tm := time.NewTimer(0)
+	defer tm.Stop()
+	<-tm.C
+
+	start := time.Now()
+	i, base := 0, time.Duration(0)
+
+	//first is where each repetition after the first starts, skipping an event
+	//at 0 that falls at the same time as the last event before it.
+	first := 0
+	if evs := s.t.Events; len(evs) > 1 && evs[0].At == 0 && evs[len(evs)-1].At == s.t.Period {
+		first = 1
+	}
+
+	//next advances to the next event, returning false at the end of a trace
+	//that does not loop.
+	next := func() bool {
+		i++
+		if i == len(s.t.Events) {
+			if !s.loop {
+				return false
+			}
+			i, base = first, base+s.t.Period
+		}
+		return true
+	}
+
+	for len(s.t.Events) > 0 {
+		tm.Reset(time.Until(start.Add(base + s.t.Events[i].At)))
+		select {
+		case <-s.cls:
+			return
+		case <-tm.C:
+		}
+
+		//Gather everything that has fallen due
+		n, more := 0, true
+		for more && !start.Add(base+s.t.Events[i].At).After(time.Now()) {
+			n += s.t.Events[i].N
+			more = next()
+		}
+
+		select {
+		case s.C <- n:
+		case <-s.cls:
+			return
+		}
+
+		if !more {
+			return
+		}
+	}
+}
+
+//Done returns a channel that is closed once the TraceSource has finished,
+//either because a trace that does not loop has ended or because it was closed.
+func (s *TraceSource) Done() <-chan struct{} {
+	return s.done
+}
+
+//Close stops the TraceSource from sending any further tokens. Closing a
+//TraceSource more than once returns ErrClosed.
+func (s *TraceSource) Close() error {
+	err := ErrClosed
+	s.clsOnce.Do(func() {
+		close(s.cls)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,137 @@
+package limio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMahimahi(t *testing.T) {
+	asrt := assert.New(t)
+
+	tr, err := ParseMahimahi(strings.NewReader("1\n1\n\n3\n"))
+	asrt.NoError(err)
+	asrt.Equal([]TraceEvent{
+		{At: time.Millisecond, N: 3000},
+		{At: 3 * time.Millisecond, N: 1500},
+	}, tr.Events)
+	asrt.Equal(3*time.Millisecond, tr.Period)
+
+	_, err = ParseMahimahi(strings.NewReader("5\n4\n"))
+	asrt.ErrorIs(err, ErrInvalidTrace)
+	_, err = ParseMahimahi(strings.NewReader("x\n"))
+	asrt.ErrorIs(err, ErrInvalidTrace)
+	_, err = ParseMahimahi(strings.NewReader(""))
+	asrt.ErrorIs(err, ErrInvalidTrace)
+}
+
+func TestParseTraceCSV(t *testing.T) {
+	asrt := assert.New(t)
+
+	tr, err := ParseTraceCSV(strings.NewReader("time,bytes\n0,10KB\n1.5s, 100\n2000,5\n"))
+	asrt.NoError(err)
+	asrt.Equal([]TraceEvent{
+		{At: 0, N: 10 * KB},
+		{At: 1500 * time.Millisecond, N: 100},
+		{At: 2 * time.Second, N: 5},
+	}, tr.Events)
+	asrt.Equal(2*time.Second, tr.Period)
+
+	_, err = ParseTraceCSV(strings.NewReader("0,1\nsoon,1\n"))
+	asrt.ErrorIs(err, ErrInvalidTrace)
+	_, err = ParseTraceCSV(strings.NewReader("0,lots\n"))
+	asrt.ErrorIs(err, ErrInvalidRate)
+
+	//A bad first record is not mistaken for a header
+	_, err = ParseTraceCSV(strings.NewReader("1x,1\n2,1\n"))
+	asrt.ErrorIs(err, ErrInvalidTrace)
+	for _, at := range []string{"Inf", "+Inf", "NaN", "1e300", "-5"} {
+		_, err = ParseTraceCSV(strings.NewReader("0,1\n" + at + ",1\n"))
+		asrt.ErrorIs(err, ErrInvalidTrace, at)
+	}
+}
+
+func TestReadTrace(t *testing.T) {
+	asrt := assert.New(t)
+	dir := t.TempDir()
+
+	mm := filepath.Join(dir, "lte.down")
+	asrt.NoError(os.WriteFile(mm, []byte("10\n20\n"), 0644))
+	tr, err := ReadTrace(mm)
+	asrt.NoError(err)
+	asrt.Len(tr.Events, 2)
+
+	c := filepath.Join(dir, "lte.CSV")
+	asrt.NoError(os.WriteFile(c, []byte("10,1\n"), 0644))
+	tr, err = ReadTrace(c)
+	asrt.NoError(err)
+	asrt.Equal([]TraceEvent{{At: 10 * time.Millisecond, N: 1}}, tr.Events)
+}
+
+func TestTraceSource(t *testing.T) {
+	asrt := assert.New(t)
+
+	tr := &Trace{
+		Events: []TraceEvent{{At: 0, N: 10}, {At: 30 * time.Millisecond, N: 20}},
+		Period: 30 * time.Millisecond,
+	}
+
+	//Played once
+	s := NewTraceSource(tr, false)
+	asrt.Equal(10, <-s.C)
+	asrt.Equal(20, <-s.C)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Error("a trace that does not loop should finish")
+	}
+	_, ok := <-s.C
+	asrt.False(ok, "C should be closed once the trace ends")
+	asrt.NoError(s.Close())
+	asrt.Equal(ErrClosed, s.Close())
+
+	//Looped: the last event of each loop is also the start of the next, so
+	//the event at 0 is not delivered again
+	s = NewTraceSource(tr, true)
+	start := time.Now()
+	for _, want := range []int{10, 20, 20, 20} {
+		asrt.Equal(want, <-s.C)
+	}
+	asrt.NoError(s.Close())
+	<-s.Done()
+	asrt.True(time.Since(start) >= 90*time.Millisecond)
+
+	//Unless the trace lasts beyond its last event
+	tr.Period = 60 * time.Millisecond
+	s = NewTraceSource(tr, true)
+	defer s.Close()
+	for _, want := range []int{10, 20, 10, 20} {
+		asrt.Equal(want, <-s.C)
+	}
+}
+
+func TestTraceSourceReader(t *testing.T) {
+	asrt := assert.New(t)
+
+	tr := &Trace{Events: []TraceEvent{{At: 0, N: 100}, {At: time.Hour, N: 100}}}
+	s := NewTraceSource(tr, false)
+
+	r := NewReader(strings.NewReader(testText))
+	defer r.Close()
+	r.Limit(s.C)
+
+	n, err := r.Read(make([]byte, 1000))
+	asrt.NoError(err)
+	asrt.Equal(100, n)
+
+	//Once the source is closed, the Reader is no longer limited by it
+	asrt.NoError(s.Close())
+	<-s.Done()
+	n, err = r.Read(make([]byte, 1000))
+	asrt.NoError(err)
+	asrt.Equal(min(1000, len(testText)-100), n)
+}
@@ -0,0 +1,179 @@
+package limio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type logEntry struct {
+	at time.Time
+	n  int
+}
+
+//SlidingWindowLog is an exact Algorithm that admits at most n operations in
+//any window of length w. It records every admitted request, so memory usage
+//grows with the number of requests admitted within a single window.
+type SlidingWindowLog struct {
+	mu sync.Mutex
+
+	n   int
+	w   time.Duration
+	log []logEntry
+	sum int
+}
+
+//NewSlidingWindowLog returns a SlidingWindowLog admitting n operations in any
+//window of length w. NewSlidingWindowLog panics if n or w is not positive.
+func NewSlidingWindowLog(n int, w time.Duration) *SlidingWindowLog {
+	if n <= 0 || w <= 0 {
+		panic("limio: non-positive rate for NewSlidingWindowLog")
+	}
+	return &SlidingWindowLog{n: n, w: w}
+}
+
+//AllowN implements the limio.Algorithm interface.
+func (s *SlidingWindowLog) AllowN(now time.Time, n int) (bool, time.Duration) {
+	if n > s.n {
+		return false, -1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := now.Add(-s.w)
+	i := 0
+	for ; i < len(s.log) && !s.log[i].at.After(start); i++ {
+		s.sum -= s.log[i].n
+	}
+	s.log = s.log[i:]
+
+	if s.sum+n <= s.n {
+		s.log = append(s.log, logEntry{now, n})
+		s.sum += n
+		return true, 0
+	}
+
+	//Find the oldest entry whose expiry frees enough room
+	free := s.n - s.sum
+	for _, e := range s.log {
+		free += e.n
+		if free >= n {
+			return false, e.at.Add(s.w).Sub(now)
+		}
+	}
+	return false, s.w
+}
+
+//SlidingWindowCounter approximates a sliding window by weighting the count of
+//the previous fixed window by how much of it still overlaps the sliding
+//window. It uses constant memory, at the cost of some precision.
+type SlidingWindowCounter struct {
+	mu sync.Mutex
+
+	n int
+	w time.Duration
+
+	start      time.Time
+	prev, curr int
+}
+
+//NewSlidingWindowCounter returns a SlidingWindowCounter admitting roughly n
+//operations in any window of length w. NewSlidingWindowCounter panics if n or
+//w is not positive.
+func NewSlidingWindowCounter(n int, w time.Duration) *SlidingWindowCounter {
+	if n <= 0 || w <= 0 {
+		panic("limio: non-positive rate for NewSlidingWindowCounter")
+	}
+	return &SlidingWindowCounter{n: n, w: w}
+}
+
+//advance must be called with the lock held.
+func (s *SlidingWindowCounter) advance(now time.Time) {
+	if s.start.IsZero() {
+		s.start = now.Truncate(s.w)
+	}
+
+	switch elapsed := now.Sub(s.start); {
+	case elapsed >= 2*s.w:
+		s.prev, s.curr = 0, 0
+		s.start = now.Truncate(s.w)
+	case elapsed >= s.w:
+		s.prev, s.curr = s.curr, 0
+		s.start = s.start.Add(s.w)
+	}
+}
+
+//AllowN implements the limio.Algorithm interface.
+func (s *SlidingWindowCounter) AllowN(now time.Time, n int) (bool, time.Duration) {
+	if n > s.n {
+		return false, -1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(now)
+
+	elapsed := now.Sub(s.start)
+	weight := 1 - float64(elapsed)/float64(s.w)
+	if float64(s.prev)*weight+float64(s.curr+n) <= float64(s.n) {
+		s.curr += n
+		return true, 0
+	}
+
+	//The time at which prev*(1-(elapsed+d)/w) + curr + n <= limit, carrying
+	//over into the next window if the current one alone is too full.
+	if s.curr+n <= s.n {
+		need := s.w - s.w*time.Duration(s.n-s.curr-n)/time.Duration(s.prev)
+		if wait := need - elapsed; wait > 0 {
+			return false, wait
+		}
+		return false, time.Nanosecond
+	}
+
+	wait := s.w - elapsed
+	if s.curr > s.n-n {
+		wait += s.w - s.w*time.Duration(s.n-n)/time.Duration(s.curr)
+	}
+	return false, wait
+}
+
+//Quota implements the limio.QuotaReporter interface.
+func (s *SlidingWindowLog) Quota(now time.Time) Quota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := now.Add(-s.w)
+	q := Quota{Limit: s.n, Remaining: s.n}
+	for _, e := range s.log {
+		if e.at.After(start) {
+			q.Remaining -= e.n
+			q.Reset = e.at.Add(s.w).Sub(now)
+		}
+	}
+	q.Remaining = max(q.Remaining, 0)
+	return q
+}
+
+//Quota implements the limio.QuotaReporter interface.
+func (s *SlidingWindowCounter) Quota(now time.Time) Quota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(now)
+
+	elapsed := now.Sub(s.start)
+	weight := 1 - float64(elapsed)/float64(s.w)
+	used := int(math.Ceil(float64(s.prev)*weight)) + s.curr
+
+	q := Quota{Limit: s.n, Remaining: max(s.n-used, 0)}
+	switch {
+	case s.curr > 0:
+		//curr counts until the end of the next window
+		q.Reset = 2*s.w - elapsed
+	case s.prev > 0:
+		q.Reset = s.w - elapsed
+	}
+	return q
+}
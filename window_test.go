@@ -0,0 +1,87 @@
+package limio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowLog(t *testing.T) {
+	asrt := assert.New(t)
+
+	s := NewSlidingWindowLog(3, time.Second)
+	now := time.Now()
+
+	ok, _ := s.AllowN(now, 2)
+	asrt.True(ok)
+	ok, _ = s.AllowN(now.Add(500*time.Millisecond), 1)
+	asrt.True(ok)
+
+	ok, wait := s.AllowN(now.Add(600*time.Millisecond), 2)
+	asrt.False(ok)
+	asrt.Equal(400*time.Millisecond, wait, "should wait for the first entry to expire")
+
+	ok, _ = s.AllowN(now.Add(time.Second), 2)
+	asrt.True(ok)
+
+	ok, wait = s.AllowN(now, 4)
+	asrt.False(ok)
+	asrt.True(wait < 0)
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	asrt := assert.New(t)
+
+	s := NewSlidingWindowCounter(10, time.Second)
+	now := time.Now().Truncate(time.Second)
+
+	ok, _ := s.AllowN(now, 10)
+	asrt.True(ok)
+
+	ok, wait := s.AllowN(now.Add(100*time.Millisecond), 1)
+	asrt.False(ok)
+	asrt.Equal(1000*time.Millisecond, wait)
+
+	//Half of the previous window still counts
+	ok, _ = s.AllowN(now.Add(1500*time.Millisecond), 5)
+	asrt.True(ok)
+	ok, wait = s.AllowN(now.Add(1500*time.Millisecond), 1)
+	asrt.False(ok)
+	asrt.True(wait > 0)
+
+	ok, _ = s.AllowN(now.Add(1500*time.Millisecond).Add(wait), 1)
+	asrt.True(ok)
+}
+
+func TestSlidingWindowQuota(t *testing.T) {
+	asrt := assert.New(t)
+
+	l := NewSlidingWindowLog(3, time.Second)
+	now := time.Now()
+	asrt.Equal(Quota{Limit: 3, Remaining: 3}, l.Quota(now))
+	l.AllowN(now, 2)
+	l.AllowN(now.Add(500*time.Millisecond), 1)
+	asrt.Equal(Quota{Limit: 3, Remaining: 0, Reset: 900 * time.Millisecond}, l.Quota(now.Add(600*time.Millisecond)))
+	asrt.Equal(Quota{Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}, l.Quota(now.Add(time.Second)))
+
+	c := NewSlidingWindowCounter(10, time.Second)
+	now = time.Now().Truncate(time.Second)
+	c.AllowN(now, 4)
+	asrt.Equal(Quota{Limit: 10, Remaining: 6, Reset: 2 * time.Second}, c.Quota(now))
+
+	//Half of the previous window still counts
+	asrt.Equal(Quota{Limit: 10, Remaining: 8, Reset: 500 * time.Millisecond}, c.Quota(now.Add(1500*time.Millisecond)))
+}
+
+func TestSlidingWindowInvalid(t *testing.T) {
+	asrt := assert.New(t)
+
+	for _, c := range []struct {
+		n int
+		w time.Duration
+	}{{0, time.Second}, {-1, time.Second}, {10, 0}, {10, -time.Second}} {
+		asrt.Panics(func() { NewSlidingWindowLog(c.n, c.w) }, "%d per %v", c.n, c.w)
+		asrt.Panics(func() { NewSlidingWindowCounter(c.n, c.w) }, "%d per %v", c.n, c.w)
+	}
+}